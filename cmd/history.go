@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/history"
+	"github.com/KevinWang15/k/pkg/kubectlk"
+	"github.com/KevinWang15/k/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var historyFilter struct {
+	cluster string
+	verb    string
+	since   string
+	until   string
+	limit   int
+}
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the history of kubectl-k invocations",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := history.Filter{
+			Cluster: historyFilter.cluster,
+			Verb:    historyFilter.verb,
+		}
+		var err error
+		if historyFilter.since != "" {
+			if filter.Since, err = utils.ParseTime(historyFilter.since); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if historyFilter.until != "" {
+			if filter.Until, err = utils.ParseTime(historyFilter.until); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		entries, err := history.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var matched []history.Entry
+		for _, entry := range entries {
+			if filter.Matches(entry) {
+				matched = append(matched, entry)
+			}
+		}
+		if historyFilter.limit > 0 && len(matched) > historyFilter.limit {
+			matched = matched[len(matched)-historyFilter.limit:]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tUSER\tCLUSTER\tNAMESPACE\tEXIT\tDURATION\tCOMMAND")
+		for _, entry := range matched {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				entry.ID,
+				entry.Timestamp.Local().Format(time.DateTime),
+				entry.User,
+				entry.Cluster,
+				entry.Namespace,
+				entry.ExitCode,
+				(time.Duration(entry.DurationMs) * time.Millisecond).String(),
+				entry.CommandLine(),
+			)
+		}
+		w.Flush()
+	},
+}
+
+var HistoryRerunCmd = &cobra.Command{
+	Use:   "rerun <id>",
+	Short: "Run a kubectl-k invocation from the history again",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid id %q\n", args[0])
+			os.Exit(1)
+		}
+
+		entry, err := history.Get(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Without a context, the invocation would run against today's K_CLUSTER
+		if kubectlk.ParseArgs(entry.Argv).Context == "" && entry.Cluster != "" {
+			entry.Argv = append([]string{"--context", entry.Cluster}, entry.Argv...)
+		}
+
+		fmt.Fprintf(os.Stderr, "Running: kubectl-k %s\n", entry.CommandLine())
+		kubectlk.Run(entry.Argv)
+	},
+}
+
+func init() {
+	HistoryCmd.Flags().StringVar(&historyFilter.cluster, "cluster", "", "only show invocations against this cluster")
+	HistoryCmd.Flags().StringVar(&historyFilter.verb, "verb", "", "only show invocations of this verb (e.g. delete)")
+	HistoryCmd.Flags().StringVar(&historyFilter.since, "since", "", "only show invocations after this time (e.g. 2h or 2006-01-02)")
+	HistoryCmd.Flags().StringVar(&historyFilter.until, "until", "", "only show invocations before this time (e.g. 30m or 2006-01-02T15:04:05)")
+	HistoryCmd.Flags().IntVar(&historyFilter.limit, "limit", 0, "only show the last N matching invocations")
+
+	HistoryCmd.AddCommand(HistoryRerunCmd)
+}
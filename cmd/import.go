@@ -89,6 +89,13 @@ func importKubeconfig() error {
 		exists := false
 		for i, existing := range config.Clusters {
 			if existing.Name == name {
+				// Only the connection is imported, the safety settings are kept
+				newCluster.Environment = existing.Environment
+				newCluster.Protected = existing.Protected
+				newCluster.Color = existing.Color
+				newCluster.ReadOnly = existing.ReadOnly
+				newCluster.ReadOnlyIdentity = existing.ReadOnlyIdentity
+				newCluster.Preview = existing.Preview
 				config.Clusters[i] = newCluster
 				exists = true
 				break
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/KevinWang15/k/pkg/kubectlk"
+	"github.com/spf13/cobra"
+)
+
+var KubectlCmd = &cobra.Command{
+	Use:                "kubectl",
+	Short:              "kubectl (internal command)",
+	Long:               `kubectl (internal command). Runs kubectl against the merged kubeconfig, used by the kubectl-k shell function.`,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		kubectlk.Run(args)
+	},
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/revisions"
+	"github.com/KevinWang15/k/pkg/watchchanges"
+	"github.com/spf13/cobra"
+)
+
+// revisionsFieldsShown is the number of changed fields listed per revision
+const revisionsFieldsShown = 3
+
+var revisionsNamespace string
+
+var RevisionsCmd = &cobra.Command{
+	Use:   "revisions [cluster] <kind>/<name>",
+	Short: "Show the revisions of an object stored by watch-changes --store-revisions",
+	Long: `Show the revisions of an object stored by watch-changes --store-revisions.
+
+The cluster defaults to $K_CLUSTER, e.g.
+  k revisions l deploy/foo
+  k revisions diff l deploy/foo 3 7`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		object := findRevisionsObject(args[:len(args)-1], args[len(args)-1])
+		entries, err := revisions.Load(object)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REV\tTIME\tEVENT\tUID\tCHANGED FIELDS")
+		var previous interface{}
+		for _, entry := range entries {
+			current := unmarshalRevision(entry)
+			fields := ""
+			if entry.EventType == "MODIFIED" && previous != nil {
+				fields = summarizeFields(watchchanges.ChangedFieldPaths(previous, current))
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+				entry.ID,
+				entry.Timestamp.Local().Format(time.DateTime),
+				entry.EventType,
+				entry.UID,
+				fields,
+			)
+			previous = current
+		}
+		w.Flush()
+	},
+}
+
+var RevisionsDiffCmd = &cobra.Command{
+	Use:   "diff [cluster] <kind>/<name> <rev> <rev>",
+	Short: "Show the diff between two stored revisions of an object",
+	Args:  cobra.RangeArgs(3, 4),
+	Run: func(cmd *cobra.Command, args []string) {
+		n := len(args)
+		object := findRevisionsObject(args[:n-3], args[n-3])
+
+		var objects [2]map[string]interface{}
+		for i, arg := range args[n-2:] {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid revision %q\n", arg)
+				os.Exit(1)
+			}
+			entry, err := revisions.Get(object, id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			objects[i], _ = unmarshalRevision(entry).(map[string]interface{})
+		}
+
+		diff := watchchanges.RenderObjectDiff(objects[0], objects[1])
+		if diff == "" {
+			fmt.Println("No changes")
+			return
+		}
+		fmt.Print(diff)
+	},
+}
+
+// findRevisionsObject resolves the object of `k revisions`, clusterArgs has the
+// cluster if it was given
+func findRevisionsObject(clusterArgs []string, kindAndName string) revisions.Object {
+	cluster := os.Getenv(consts.K_CLUSTER)
+	if len(clusterArgs) > 0 {
+		cluster = clusterArgs[0]
+	}
+	if cluster == "" {
+		fmt.Fprintf(os.Stderr, "Error: no cluster given and %s is not set\n", consts.K_CLUSTER)
+		os.Exit(1)
+	}
+
+	object, err := revisions.Find(cluster, kindAndName, revisionsNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return object
+}
+
+func unmarshalRevision(entry revisions.Entry) interface{} {
+	var object interface{}
+	if err := json.Unmarshal(entry.Object, &object); err != nil {
+		panic(fmt.Errorf("failed to unmarshal revision %d: %w", entry.ID, err))
+	}
+	return object
+}
+
+func summarizeFields(paths []string) string {
+	if len(paths) <= revisionsFieldsShown {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:revisionsFieldsShown], ", "), len(paths)-revisionsFieldsShown)
+}
+
+func init() {
+	RevisionsCmd.PersistentFlags().StringVarP(&revisionsNamespace, "namespace", "n", "", "namespace of the object, only needed if objects with that name were seen in several namespaces")
+
+	RevisionsCmd.AddCommand(RevisionsDiffCmd)
+}
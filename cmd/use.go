@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var UseCmd = &cobra.Command{
+	Use:   "use [cluster]",
+	Short: "Select the cluster kubectl-k uses when no --context is given",
+	Long: `Select the cluster kubectl-k uses when no --context is given, for the current shell session.
+Without a cluster, the selection is cleared. Prints the shell commands to run, the k function
+defined by "source <(k rc)" runs them for you.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Printf("unset %s\n", consts.K_CLUSTER)
+			return
+		}
+
+		if _, ok := utils.GetConfig().FindCluster(args[0]); !ok {
+			fmt.Fprintf(os.Stderr, "Error: cluster %q doesn't exist in %s\n", args[0], utils.GetConfigPath())
+			os.Exit(1)
+		}
+		fmt.Printf("export %s=%q\n", consts.K_CLUSTER, args[0])
+	},
+}
@@ -1,14 +1,192 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/utils"
 	"github.com/KevinWang15/k/pkg/watchchanges"
 	"github.com/spf13/cobra"
 )
 
+// watchChangesOptions are shared by watch-changes and its subcommands
+var watchChangesOptions watchchanges.Options
+
+var watchChangesNativeOptions watchchanges.NativeOptions
+
+var watchChangesReplayOptions struct {
+	since string
+	until string
+	speed float64
+}
+
 var WatchChangesCmd = &cobra.Command{
-	Use:   "watch-changes",
-	Short: "watch-changes (internal command)",
+	Use:   "watch-changes [<cluster> <resource> [name]]",
+	Short: "Watch resources and show their changes as diffs",
+	Long: `Watch resources and show their changes as diffs.
+
+With a cluster and a resource, k watches the resource itself, e.g.
+  k watch-changes l deploy
+  k watch-changes l configmap my-config -n kube-system
+  k watch-changes l deploy,rs,po -l app=foo
+  k watch-changes l all --owner deploy/foo
+
+Without arguments, it reads the output of "kubectl get -ojson --output-watch-events --watch"
+from stdin (this is what the watch-changes shell function does).`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return nil
+		}
+		return cobra.RangeArgs(2, 3)(cmd, args)
+	},
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if o := watchChangesOptions.Output; o != watchchanges.OutputText && o != watchchanges.OutputJSONL && o != watchchanges.OutputSummary && o != watchchanges.OutputTUI {
+			fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", o)
+			os.Exit(1)
+		}
+		if f := watchChangesOptions.Format; f != watchchanges.FormatJSON && f != watchchanges.FormatYAML {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", f)
+			os.Exit(1)
+		}
+		if d := watchChangesOptions.OnDelete; d != watchchanges.OnDeleteName && d != watchchanges.OnDeleteBody && d != watchchanges.OnDeleteDiff {
+			fmt.Fprintf(os.Stderr, "Error: unknown --on-delete %q\n", d)
+			os.Exit(1)
+		}
+		if err := watchChangesOptions.Filter.Compile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if m := watchChangesOptions.DiffMode; m != watchchanges.DiffModeUnified && m != watchchanges.DiffModeField {
+			fmt.Fprintf(os.Stderr, "Error: unknown diff mode %q\n", m)
+			os.Exit(1)
+		}
+		if watchChangesOptions.Baseline != "" && watchChangesOptions.Output == watchchanges.OutputSummary {
+			fmt.Fprintf(os.Stderr, "Error: --baseline can't be used with -o summary, which counts changes rather than drift\n")
+			os.Exit(1)
+		}
+		if h := watchChangesOptions.Headlines; h != watchchanges.HeadlinesAbove && h != watchchanges.HeadlinesOnly && h != watchchanges.HeadlinesOff {
+			fmt.Fprintf(os.Stderr, "Error: unknown --headlines %q\n", h)
+			os.Exit(1)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		watchchanges.Run()
+		if len(args) == 0 {
+			watchchanges.Run(watchChangesOptions)
+			return
+		}
+
+		watchChangesNativeOptions.Options = watchChangesOptions
+		watchChangesNativeOptions.Cluster = args[0]
+		watchChangesNativeOptions.Resource = args[1]
+		if len(args) > 2 {
+			watchChangesNativeOptions.Name = args[2]
+		}
+		watchchanges.RunNative(watchChangesNativeOptions)
 	},
 }
+
+var WatchChangesReplayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Replay the events recorded with watch-changes --record",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := watchchanges.ReplayOptions{
+			Options: watchChangesOptions,
+			File:    args[0],
+			Speed:   watchChangesReplayOptions.speed,
+		}
+
+		var err error
+		if watchChangesReplayOptions.since != "" {
+			if opts.Since, err = utils.ParseTime(watchChangesReplayOptions.since); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if watchChangesReplayOptions.until != "" {
+			if opts.Until, err = utils.ParseTime(watchChangesReplayOptions.until); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		watchchanges.Replay(opts)
+	},
+}
+
+func init() {
+	flags := WatchChangesCmd.PersistentFlags()
+	flags.StringVarP(&watchChangesOptions.Output, "output", "o", watchchanges.OutputText, "output format, text, jsonl (one JSON record with a JSON Patch per event) summary (statistics of the changes) or tui (browse objects and their revisions interactively)")
+	flags.DurationVar(&watchChangesOptions.SummaryInterval, "summary-interval", 0, "with -o summary, print the summary of the last interval this often (e.g. 5m), by default it is only printed on exit")
+	flags.StringVar(&watchChangesOptions.DiffMode, "diff-mode", envOrDefault(consts.K_DIFF_MODE, watchchanges.DiffModeUnified), "how changes are shown, unified (a line diff) or field (one line per changed field)")
+	flags.StringVar(&watchChangesOptions.Format, "format", envOrDefault(consts.K_DIFF_FORMAT, watchchanges.FormatJSON), "format of the objects in diffs and added bodies, json or yaml")
+	flags.StringVar(&watchChangesOptions.OnDelete, "on-delete", envOrDefault(consts.K_ON_DELETE, watchchanges.OnDeleteName), "what is shown for deleted objects, name, body (their final state) or diff (since they were last seen)")
+	flags.IntVar(&watchChangesOptions.MaxTracked, "max-tracked", envIntOrDefault(consts.K_MAX_TRACKED, 0), "keep the state of at most this many objects, forgetting the least recently seen ones, 0 means no limit")
+	flags.DurationVar(&watchChangesOptions.TrackedTTL, "tracked-ttl", envDurationOrDefault(consts.K_TRACKED_TTL, 0), "forget the state of objects not seen for this long (e.g. 1h), 0 means never")
+	flags.BoolVar(&watchChangesOptions.ShowSecrets, "show-secrets", false, "show the data of Secrets and the configured redact paths instead of hashes of them")
+	flags.BoolVar(&watchChangesOptions.DecodeSecrets, "decode-secrets", false, "show the data of Secrets base64 decoded, implies --show-secrets")
+	flags.StringSliceVar(&watchChangesOptions.Filter.EventTypes, "event-type", nil, "only show these event types (ADDED, MODIFIED, DELETED or ERROR, and DRIFTED or SYNCED with --baseline)")
+	flags.StringVar(&watchChangesOptions.Filter.NameRegex, "name-regex", "", "only show objects whose name matches this regular expression")
+	flags.StringVar(&watchChangesOptions.Filter.NamespaceRegex, "namespace-regex", "", "only show objects whose namespace matches this regular expression")
+	flags.StringVar(&watchChangesOptions.Filter.LabelSelector, "label-filter", "", "only show objects whose labels match this selector (e.g. app=foo,tier!=db), checked on every change")
+	flags.StringVar(&watchChangesOptions.Filter.AnnotationSelector, "annotation-filter", "", "only show objects whose annotations match this selector, checked on every change")
+	flags.StringArrayVar(&watchChangesOptions.Filter.ChangedPaths, "changed-path", nil, "only show modifications of this field path (e.g. spec.template.spec.containers[*].image), can be repeated")
+	flags.BoolVar(&watchChangesOptions.Hooks, "hooks", false, "run the hooks of ~/.k/config.json on matching changes")
+	WatchChangesCmd.Flags().BoolVar(&watchChangesOptions.StoreRevisions, "store-revisions", false, "keep every revision of the objects in ~/.k/revisions, to look at them later with k revisions")
+	flags.BoolVar(&watchChangesOptions.ExpandEmbedded, "expand-embedded", true, "diff the JSON and YAML documents embedded in ConfigMaps and annotations field by field, and other multi-line values line by line")
+	flags.BoolVar(&watchChangesOptions.IncludeObjects, "include-objects", false, "with -o jsonl, include the full old and new objects in every record")
+	flags.StringVar(&watchChangesOptions.Headlines, "headlines", envOrDefault(consts.K_HEADLINES, watchchanges.HeadlinesAbove), "one-line summaries of condition transitions, rollouts, restarts and image changes: above (the diff), only (instead of the diff) or off")
+	flags.StringVar(&watchChangesOptions.Baseline, "baseline", "", "a directory of manifests (e.g. a Git checkout), to show how the watched objects drift from them instead of their changes")
+
+	WatchChangesCmd.Flags().StringVar(&watchChangesOptions.Cluster, "cluster", os.Getenv(consts.K_CLUSTER), "the cluster the events read from stdin come from, for --store-revisions")
+	WatchChangesCmd.Flags().StringVar(&watchChangesOptions.Record, "record", os.Getenv(consts.K_RECORD), "append the raw events to this file, to replay them later with watch-changes replay")
+	WatchChangesCmd.Flags().StringVarP(&watchChangesNativeOptions.Namespace, "namespace", "n", "", "namespace to watch, defaults to $K_DEFAULT_NAMESPACE or the namespace of the cluster")
+	WatchChangesCmd.Flags().BoolVarP(&watchChangesNativeOptions.AllNamespaces, "all-namespaces", "A", false, "watch all namespaces")
+	WatchChangesCmd.Flags().StringVarP(&watchChangesNativeOptions.Selector, "selector", "l", "", "label selector of the objects to watch")
+	WatchChangesCmd.Flags().StringVar(&watchChangesNativeOptions.Owner, "owner", "", "only show this object (e.g. deploy/foo) and the objects it owns, intermediate kinds must be watched too")
+
+	WatchChangesReplayCmd.Flags().StringVar(&watchChangesReplayOptions.since, "since", "", "only show events after this time (e.g. 2h or 2006-01-02T15:04:05)")
+	WatchChangesReplayCmd.Flags().StringVar(&watchChangesReplayOptions.until, "until", "", "only show events before this time (e.g. 30m or 2006-01-02T15:04:05)")
+	WatchChangesReplayCmd.Flags().Float64Var(&watchChangesReplayOptions.speed, "speed", 0, "replay speed relative to real time (e.g. 1 or 10), 0 replays without delays")
+	WatchChangesReplayCmd.Flags().StringVar(&watchChangesOptions.Filter.Kind, "kind", "", "only show objects of this kind")
+	WatchChangesReplayCmd.Flags().StringVar(&watchChangesOptions.Filter.Namespace, "namespace", "", "only show objects in this namespace")
+	WatchChangesReplayCmd.Flags().StringVar(&watchChangesOptions.Filter.Name, "name", "", "only show objects with this name")
+
+	WatchChangesCmd.AddCommand(WatchChangesReplayCmd)
+}
+
+// envOrDefault lets environment variables provide flag defaults, for the options
+// that need to reach `k watch-changes` through the watch-changes shell function
+func envOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func envIntOrDefault(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Errorf("failed to parse %s: %w", name, err))
+	}
+	return result
+}
+
+func envDurationOrDefault(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Errorf("failed to parse %s: %w", name, err))
+	}
+	return result
+}
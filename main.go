@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/KevinWang15/k/cmd"
+	"github.com/KevinWang15/k/pkg/colors"
 	"github.com/spf13/cobra"
 )
 
@@ -10,10 +14,24 @@ func main() {
 		Use: "k",
 	}
 
+	var colorMode, theme string
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", "", "When to color the output: auto, always or never (default auto, or $K_COLOR)")
+	rootCmd.PersistentFlags().StringVar(&theme, "theme", "", "Color theme: default or colorblind (default $K_THEME, or theme in config.json)")
+	cobra.OnInitialize(func() {
+		if err := colors.Setup(colorMode, theme); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	})
+
 	rootCmd.AddCommand(cmd.RcCmd)
 	rootCmd.AddCommand(cmd.WatchChangesCmd)
 	rootCmd.AddCommand(cmd.GetAllClustersCmd)
 	rootCmd.AddCommand(cmd.ImportCommand)
+	rootCmd.AddCommand(cmd.KubectlCmd)
+	rootCmd.AddCommand(cmd.HistoryCmd)
+	rootCmd.AddCommand(cmd.UseCmd)
+	rootCmd.AddCommand(cmd.RevisionsCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		panic(err)
@@ -0,0 +1,192 @@
+package colors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/fatih/color"
+)
+
+// Modes of --color
+const (
+	ModeAuto   = "auto"
+	ModeAlways = "always"
+	ModeNever  = "never"
+)
+
+// Themes of --theme
+const (
+	ThemeDefault    = "default"
+	ThemeColorblind = "colorblind"
+)
+
+// The colors every k command prints with. They are set by Setup according to the
+// theme, and print plain text when colors are disabled.
+var (
+	Bold  *color.Color
+	Faint *color.Color
+
+	// Added and Removed are the colors of added and removed lines and values,
+	// AddedHighlight and RemovedHighlight of the words that changed within them
+	Added            *color.Color
+	Removed          *color.Color
+	AddedHighlight   *color.Color
+	RemovedHighlight *color.Color
+
+	// AddedLabel, ModifiedLabel and RemovedLabel are the colors of event types
+	AddedLabel    *color.Color
+	ModifiedLabel *color.Color
+	RemovedLabel  *color.Color
+
+	Warning *color.Color
+	Danger  *color.Color
+
+	// Kinds are handed out to the kinds of objects, to tell them apart
+	Kinds []*color.Color
+)
+
+var mode = ModeAuto
+
+// named are the colors that can be chosen by name, e.g. for clusters in config.json
+var named = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+func init() {
+	applyTheme(ThemeDefault)
+}
+
+// Setup applies a color mode and a theme, empty values fall back to $K_COLOR and
+// $K_THEME, then to the theme of config.json and the defaults. With ModeAuto,
+// colors are only used when stdout is a terminal and $NO_COLOR is not set.
+func Setup(colorMode, theme string) error {
+	if colorMode == "" {
+		colorMode = os.Getenv(consts.K_COLOR)
+	}
+	if colorMode == "" {
+		colorMode = ModeAuto
+	}
+	switch colorMode {
+	case ModeAuto:
+		// fatih/color already checks $NO_COLOR and whether stdout is a terminal
+	case ModeAlways:
+		color.NoColor = false
+	case ModeNever:
+		color.NoColor = true
+	default:
+		return fmt.Errorf("unknown color mode %q, expected auto, always or never", colorMode)
+	}
+	mode = colorMode
+
+	if theme == "" {
+		theme = os.Getenv(consts.K_THEME)
+	}
+	if theme == "" {
+		theme = configTheme()
+	}
+	if theme == "" {
+		theme = ThemeDefault
+	}
+	return applyTheme(theme)
+}
+
+// configTheme reads the theme of config.json. Errors are left to the commands that
+// use the config, so that a broken config.json doesn't break every command.
+func configTheme() string {
+	data, err := os.ReadFile(path.Join(consts.K_HOME_DIR, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var config model.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ""
+	}
+	return config.Theme
+}
+
+// ForTerminal enables colors for output that goes to a terminal other than
+// stdout (e.g. /dev/tty), unless they were turned off with --color=never or $NO_COLOR
+func ForTerminal() {
+	if mode != ModeNever && os.Getenv("NO_COLOR") == "" {
+		color.NoColor = false
+	}
+}
+
+// Named returns the bold color of a name (e.g. "red"), false if there is no such color
+func Named(name string) (*color.Color, bool) {
+	attribute, ok := named[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	return newColor(attribute, color.Bold), true
+}
+
+func applyTheme(theme string) error {
+	switch theme {
+	case ThemeDefault:
+		Added = newColor(color.FgGreen)
+		Removed = newColor(color.FgRed)
+		AddedHighlight = newColor(color.FgHiWhite, color.BgGreen)
+		RemovedHighlight = newColor(color.FgHiWhite, color.BgRed)
+		AddedLabel = newColor(color.FgGreen, color.Bold)
+		ModifiedLabel = newColor(color.FgYellow, color.Bold)
+		RemovedLabel = newColor(color.FgRed, color.Bold)
+		Warning = newColor(color.FgYellow, color.Bold)
+		Danger = newColor(color.FgRed, color.Bold)
+		Kinds = []*color.Color{
+			newColor(color.FgCyan),
+			newColor(color.FgMagenta),
+			newColor(color.FgBlue),
+			newColor(color.FgHiCyan),
+			newColor(color.FgHiMagenta),
+			newColor(color.FgHiBlue),
+		}
+	case ThemeColorblind:
+		// Blue and orange-ish yellow rather than green and red, which look alike
+		// with the most common kinds of color blindness
+		Added = newColor(color.FgBlue)
+		Removed = newColor(color.FgYellow)
+		AddedHighlight = newColor(color.FgHiWhite, color.BgBlue)
+		RemovedHighlight = newColor(color.FgBlack, color.BgYellow)
+		AddedLabel = newColor(color.FgBlue, color.Bold)
+		ModifiedLabel = newColor(color.FgMagenta, color.Bold)
+		RemovedLabel = newColor(color.FgYellow, color.Bold)
+		Warning = newColor(color.FgMagenta, color.Bold)
+		Danger = newColor(color.FgYellow, color.Bold)
+		Kinds = []*color.Color{
+			newColor(color.FgCyan),
+			newColor(color.FgHiBlue),
+			newColor(color.FgHiMagenta),
+			newColor(color.FgHiCyan),
+			newColor(color.FgWhite, color.Bold),
+			newColor(color.FgHiYellow),
+		}
+	default:
+		return fmt.Errorf("unknown theme %q, expected default or colorblind", theme)
+	}
+
+	Bold = newColor(color.Bold)
+	Faint = newColor(color.FgWhite, color.Faint)
+	return nil
+}
+
+// newColor creates a color, --color=always takes precedence over $NO_COLOR
+func newColor(attributes ...color.Attribute) *color.Color {
+	c := color.New(attributes...)
+	if mode == ModeAlways {
+		c.EnableColor()
+	}
+	return c
+}
@@ -2,3 +2,19 @@ package consts
 
 const K_PRINT_BODY_OF_ADDED = "K_PRINT_BODY_OF_ADDED"
 const K_DIFF_CONTEXT_LINES = "K_DIFF_CONTEXT_LINES"
+const K_PREVIEW = "K_PREVIEW"
+const K_CLUSTER = "K_CLUSTER"
+const K_DEFAULT_NAMESPACE = "K_DEFAULT_NAMESPACE"
+const K_IGNORE_PATHS = "K_IGNORE_PATHS"
+const K_DIFF_MODE = "K_DIFF_MODE"
+const K_DIFF_FORMAT = "K_DIFF_FORMAT"
+const K_RECORD = "K_RECORD"
+const K_ON_DELETE = "K_ON_DELETE"
+const K_MAX_TRACKED = "K_MAX_TRACKED"
+const K_TRACKED_TTL = "K_TRACKED_TTL"
+const K_REDACT_PATHS = "K_REDACT_PATHS"
+const K_DIFF_MAX_LINE_LENGTH = "K_DIFF_MAX_LINE_LENGTH"
+const K_COLOR = "K_COLOR"
+const K_THEME = "K_THEME"
+const K_HEADLINES = "K_HEADLINES"
+const K_MAX_REVISIONS = "K_MAX_REVISIONS"
@@ -14,3 +14,18 @@ var K_HOME_DIR = func() string {
 
 	return path.Join(dir, ".k")
 }()
+
+// K_KUBECONFIG_PATH is the single merged kubeconfig generated by `k rc`
+var K_KUBECONFIG_PATH = path.Join(K_HOME_DIR, "config")
+
+// K_CACHE_DIR is passed to kubectl as --cache-dir
+var K_CACHE_DIR = path.Join(K_HOME_DIR, "cache")
+
+// K_HISTORY_PATH is the JSONL log of kubectl-k invocations
+var K_HISTORY_PATH = path.Join(K_HOME_DIR, "history")
+
+// K_REVISIONS_DIR holds the revisions of objects stored by watch-changes --store-revisions
+var K_REVISIONS_DIR = path.Join(K_HOME_DIR, "revisions")
+
+// K_REDACT_KEY_PATH is the key redacted values are hashed with, created on first use
+var K_REDACT_KEY_PATH = path.Join(K_HOME_DIR, "redact.key")
@@ -0,0 +1,131 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/consts"
+)
+
+// Record is one kubectl-k invocation, stored as a line of ~/.k/history
+type Record struct {
+	Timestamp  time.Time `json:"timestamp"`
+	User       string    `json:"user,omitempty"`
+	Cluster    string    `json:"cluster"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Verb       string    `json:"verb,omitempty"`
+	Argv       []string  `json:"argv"`
+	ExitCode   int       `json:"exitCode"`
+	DurationMs int64     `json:"durationMs"`
+	// Error is why k refused to run the invocation, e.g. on a read-only cluster
+	Error string `json:"error,omitempty"`
+}
+
+// Entry is a Record along with its id, which is its 1-based line number in the history file
+type Entry struct {
+	ID int
+	Record
+}
+
+// Filter selects entries of the history, zero values match everything
+type Filter struct {
+	Cluster string
+	Verb    string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Matches reports whether the entry is selected by the filter
+func (f Filter) Matches(entry Entry) bool {
+	if f.Cluster != "" && entry.Cluster != f.Cluster {
+		return false
+	}
+	if f.Verb != "" && entry.Verb != f.Verb {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Append adds a record to the end of the history file
+func Append(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+
+	file, err := os.OpenFile(consts.K_HISTORY_PATH, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file %s: %w", consts.K_HISTORY_PATH, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history file %s: %w", consts.K_HISTORY_PATH, err)
+	}
+	return nil
+}
+
+// Load reads every entry of the history file. Lines that cannot be parsed are skipped,
+// but still count towards the ids so that ids stay stable.
+func Load() ([]Entry, error) {
+	file, err := os.Open(consts.K_HISTORY_PATH)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file %s: %w", consts.K_HISTORY_PATH, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for id := 1; scanner.Scan(); id++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		entries = append(entries, Entry{ID: id, Record: record})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file %s: %w", consts.K_HISTORY_PATH, err)
+	}
+	return entries, nil
+}
+
+// Get returns the entry with the given id
+func Get(id int) (Entry, error) {
+	entries, err := Load()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("no history entry with id %d", id)
+}
+
+// CommandLine renders the argv of a record as it was typed
+func (r Record) CommandLine() string {
+	quoted := make([]string, len(r.Argv))
+	for i, arg := range r.Argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"$\\*?;&|<>()") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		} else {
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,256 @@
+package kubectlk
+
+import (
+	"strings"
+)
+
+// mutatingVerbs are the kubectl verbs that change the state of a cluster
+var mutatingVerbs = map[string]bool{
+	"delete": true,
+	"apply":  true,
+	"edit":   true,
+	"patch":  true,
+	"scale":  true,
+	"drain":  true,
+	"touch":  true,
+}
+
+// readVerbs are the verbs allowed on read-only clusters. Anything else, including
+// unknown verbs such as kubectl plugins, is considered a write.
+var readVerbs = map[string]bool{
+	"get":           true,
+	"describe":      true,
+	"logs":          true,
+	"top":           true,
+	"explain":       true,
+	"api-resources": true,
+	"api-versions":  true,
+	"cluster-info":  true,
+	"version":       true,
+	"events":        true,
+	"diff":          true,
+	"wait":          true,
+	"kustomize":     true,
+	"completion":    true,
+	"options":       true,
+	"help":          true,
+}
+
+// readSubcommands are the subcommands of verbs that are reads only for some of them
+var readSubcommands = map[string]map[string]bool{
+	"rollout": {"status": true, "history": true},
+	"auth":    {"can-i": true, "whoami": true},
+	"config":  {"view": true, "current-context": true, "get-contexts": true, "get-clusters": true, "get-users": true},
+	"plugin":  {"list": true},
+}
+
+// otherVerbs are the remaining kubectl verbs, known to write or to give access to
+// containers, so that only plugins and typos are unknown
+var otherVerbs = map[string]bool{
+	"create":       true,
+	"replace":      true,
+	"label":        true,
+	"annotate":     true,
+	"set":          true,
+	"cordon":       true,
+	"uncordon":     true,
+	"taint":        true,
+	"expose":       true,
+	"run":          true,
+	"autoscale":    true,
+	"exec":         true,
+	"cp":           true,
+	"attach":       true,
+	"debug":        true,
+	"certificate":  true,
+	"port-forward": true,
+	"proxy":        true,
+	"alpha":        true,
+}
+
+// booleanFlags are the kubectl global flags that don't take a value, so that they
+// can come before the verb without making it ambiguous
+var booleanFlags = map[string]bool{
+	"-A":                         true,
+	"--all-namespaces":           true,
+	"--insecure-skip-tls-verify": true,
+	"--match-server-version":     true,
+	"--warnings-as-errors":       true,
+	"--disable-compression":      true,
+	"-h":                         true,
+	"--help":                     true,
+}
+
+// flagsWithValue lists the kubectl flags that consume the following argument
+// when not written as --flag=value, so that we don't mistake their values for
+// the verb or the resources.
+var flagsWithValue = map[string]bool{
+	"--context":               true,
+	"-n":                      true,
+	"--namespace":             true,
+	"--kubeconfig":            true,
+	"--cluster":               true,
+	"--user":                  true,
+	"-s":                      true,
+	"--server":                true,
+	"--token":                 true,
+	"--as":                    true,
+	"--as-group":              true,
+	"--as-uid":                true,
+	"--as-user-extra":         true,
+	"--username":              true,
+	"--password":              true,
+	"--profile":               true,
+	"--profile-output":        true,
+	"--log-flush-frequency":   true,
+	"--vmodule":               true,
+	"--cache-dir":             true,
+	"--request-timeout":       true,
+	"-v":                      true,
+	"--certificate-authority": true,
+	"--client-certificate":    true,
+	"--client-key":            true,
+	"--tls-server-name":       true,
+	"-f":                      true,
+	"--filename":              true,
+	"-k":                      true,
+	"--kustomize":             true,
+	"-l":                      true,
+	"--selector":              true,
+	"--field-selector":        true,
+	"-o":                      true,
+	"--output":                true,
+	"-p":                      true,
+	"--patch":                 true,
+	"--patch-file":            true,
+	"--type":                  true,
+	"--replicas":              true,
+	"--current-replicas":      true,
+	"--resource-version":      true,
+	"-c":                      true,
+	"--container":             true,
+	"--grace-period":          true,
+	"--timeout":               true,
+	"--field-manager":         true,
+	"--pod-selector":          true,
+}
+
+// Invocation is the result of parsing the arguments of a kubectl-k call
+type Invocation struct {
+	Args          []string
+	Context       string
+	Namespace     string
+	AllNamespaces bool
+	Verb          string
+	Resources     []string
+	Filenames     []string
+	Selector      string
+	Yes           bool
+
+	// verbIndex is the position of Verb in Args, -1 if there is no verb
+	verbIndex int
+	// ambiguous is set when an unknown flag comes before the verb, as it may take
+	// the next argument as its value, in which case Verb is not the verb
+	ambiguous bool
+}
+
+// IsUncertain reports whether what the invocation does can't be told, because
+// the verb is unknown (e.g. a plugin) or an unknown flag comes before it
+func (i Invocation) IsUncertain() bool {
+	if i.ambiguous {
+		return true
+	}
+	return i.Verb != "" && !mutatingVerbs[i.Verb] && !readVerbs[i.Verb] && readSubcommands[i.Verb] == nil && !otherVerbs[i.Verb]
+}
+
+// IsWrite reports whether the invocation may write to the cluster. It is an
+// allow-list of reads, so that anything unrecognised counts as a write.
+func (i Invocation) IsWrite() bool {
+	if i.ambiguous {
+		return true
+	}
+	if i.Verb == "" || readVerbs[i.Verb] {
+		return false
+	}
+	if subcommands, ok := readSubcommands[i.Verb]; ok {
+		return len(i.Resources) == 0 || !subcommands[i.Resources[0]]
+	}
+	return true
+}
+
+// ParseArgs extracts the bits of a kubectl command line that k cares about.
+// The --yes flag is consumed here and removed from Args, as kubectl doesn't know it.
+func ParseArgs(args []string) Invocation {
+	inv := Invocation{verbIndex: -1}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--yes" {
+			inv.Yes = true
+			continue
+		}
+		inv.Args = append(inv.Args, arg)
+
+		// Everything after "--" belongs to the command (e.g. kubectl exec)
+		if arg == "--" {
+			inv.Args = append(inv.Args, args[i+1:]...)
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if inv.Verb == "" {
+				inv.Verb = arg
+				inv.verbIndex = len(inv.Args) - 1
+			} else {
+				inv.Resources = append(inv.Resources, arg)
+			}
+			continue
+		}
+
+		if arg == "-A" || arg == "--all-namespaces" || arg == "--all-namespaces=true" {
+			inv.AllNamespaces = true
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		// Short flags may have their value attached, e.g. -nkube-system or -v4
+		if !hasValue && !strings.HasPrefix(arg, "--") && len(arg) > 2 && flagsWithValue[arg[:2]] {
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+		if inv.Verb == "" && !hasValue && !flagsWithValue[name] && !booleanFlags[name] {
+			inv.ambiguous = true
+		}
+		if !hasValue && flagsWithValue[name] && i+1 < len(args) {
+			i++
+			value = args[i]
+			inv.Args = append(inv.Args, value)
+		}
+
+		switch name {
+		case "--context":
+			inv.Context = value
+		case "-n", "--namespace":
+			inv.Namespace = value
+		case "-f", "--filename", "-k", "--kustomize":
+			inv.Filenames = append(inv.Filenames, value)
+		case "-l", "--selector":
+			inv.Selector = value
+		}
+	}
+
+	return inv
+}
+
+// ReplaceVerb returns Args with the verb replaced by the given arguments
+func (i Invocation) ReplaceVerb(replacement ...string) []string {
+	if i.verbIndex < 0 {
+		return i.Args
+	}
+
+	result := make([]string, 0, len(i.Args)+len(replacement))
+	result = append(result, i.Args[:i.verbIndex]...)
+	result = append(result, replacement...)
+	result = append(result, i.Args[i.verbIndex+1:]...)
+	return result
+}
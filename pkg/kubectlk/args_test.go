@@ -0,0 +1,183 @@
+package kubectlk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args          string
+		wantArgs      string
+		wantVerb      string
+		wantResources []string
+		wantContext   string
+		wantNamespace string
+		wantAll       bool
+		wantFilenames []string
+		wantSelector  string
+		wantYes       bool
+	}{
+		{
+			args:          "get pods",
+			wantVerb:      "get",
+			wantResources: []string{"pods"},
+		},
+		{
+			args:          "--context prod -n kube-system get pods",
+			wantVerb:      "get",
+			wantResources: []string{"pods"},
+			wantContext:   "prod",
+			wantNamespace: "kube-system",
+		},
+		{
+			args:          "--context=prod --namespace=kube-system delete pod foo",
+			wantVerb:      "delete",
+			wantResources: []string{"pod", "foo"},
+			wantContext:   "prod",
+			wantNamespace: "kube-system",
+		},
+		{
+			args:          "-nkube-system -v4 get pods",
+			wantVerb:      "get",
+			wantResources: []string{"pods"},
+			wantNamespace: "kube-system",
+		},
+		{
+			args:          "get pods -A",
+			wantVerb:      "get",
+			wantResources: []string{"pods"},
+			wantAll:       true,
+		},
+		{
+			args:          "apply -f a.yaml --filename=b.yaml -k dir",
+			wantVerb:      "apply",
+			wantFilenames: []string{"a.yaml", "b.yaml", "dir"},
+		},
+		{
+			args:          "delete pods -l app=foo",
+			wantVerb:      "delete",
+			wantResources: []string{"pods"},
+			wantSelector:  "app=foo",
+		},
+		{
+			args:          "delete pod foo --yes",
+			wantArgs:      "delete pod foo",
+			wantVerb:      "delete",
+			wantResources: []string{"pod", "foo"},
+			wantYes:       true,
+		},
+		{
+			args:          "exec foo -- ls -n --yes",
+			wantVerb:      "exec",
+			wantResources: []string{"foo"},
+		},
+		{
+			args:          "exec -n default foo -c app -- sh -c 'echo'",
+			wantVerb:      "exec",
+			wantResources: []string{"foo"},
+			wantNamespace: "default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			inv := ParseArgs(strings.Fields(tt.args))
+
+			wantArgs := tt.args
+			if tt.wantArgs != "" {
+				wantArgs = tt.wantArgs
+			}
+			if got := strings.Join(inv.Args, " "); got != wantArgs {
+				t.Errorf("Args = %q, want %q", got, wantArgs)
+			}
+			if inv.Verb != tt.wantVerb {
+				t.Errorf("Verb = %q, want %q", inv.Verb, tt.wantVerb)
+			}
+			if !reflect.DeepEqual(inv.Resources, tt.wantResources) {
+				t.Errorf("Resources = %q, want %q", inv.Resources, tt.wantResources)
+			}
+			if inv.Context != tt.wantContext {
+				t.Errorf("Context = %q, want %q", inv.Context, tt.wantContext)
+			}
+			if inv.Namespace != tt.wantNamespace {
+				t.Errorf("Namespace = %q, want %q", inv.Namespace, tt.wantNamespace)
+			}
+			if inv.AllNamespaces != tt.wantAll {
+				t.Errorf("AllNamespaces = %v, want %v", inv.AllNamespaces, tt.wantAll)
+			}
+			if !reflect.DeepEqual(inv.Filenames, tt.wantFilenames) {
+				t.Errorf("Filenames = %q, want %q", inv.Filenames, tt.wantFilenames)
+			}
+			if inv.Selector != tt.wantSelector {
+				t.Errorf("Selector = %q, want %q", inv.Selector, tt.wantSelector)
+			}
+			if inv.Yes != tt.wantYes {
+				t.Errorf("Yes = %v, want %v", inv.Yes, tt.wantYes)
+			}
+		})
+	}
+}
+
+func TestIsWrite(t *testing.T) {
+	tests := []struct {
+		args          string
+		wantWrite     bool
+		wantUncertain bool
+	}{
+		{args: "get pods", wantWrite: false},
+		{args: "describe deploy foo", wantWrite: false},
+		{args: "logs foo -f", wantWrite: false},
+		{args: "", wantWrite: false},
+		{args: "--context prod -n kube-system get pods", wantWrite: false},
+		{args: "-nkube-system -v4 get pods", wantWrite: false},
+		{args: "--as=admin get pods", wantWrite: false},
+		{args: "--as admin get pods", wantWrite: false},
+		{args: "rollout status deploy/foo", wantWrite: false},
+		{args: "rollout history deploy/foo", wantWrite: false},
+		{args: "rollout restart deploy/foo", wantWrite: true},
+		{args: "rollout undo deploy/foo", wantWrite: true},
+		{args: "rollout", wantWrite: true},
+		{args: "auth can-i delete pods", wantWrite: false},
+		{args: "auth reconcile -f rbac.yaml", wantWrite: true},
+		{args: "config view", wantWrite: false},
+		{args: "config set-context foo", wantWrite: true},
+		{args: "delete pod foo", wantWrite: true},
+		{args: "apply -f x.yaml", wantWrite: true},
+		{args: "create -f x.yaml", wantWrite: true},
+		{args: "replace --force -f x.yaml", wantWrite: true},
+		{args: "set image deploy/foo app=nginx", wantWrite: true},
+		{args: "label pod foo a=b", wantWrite: true},
+		{args: "cordon node1", wantWrite: true},
+		{args: "exec foo -- ls", wantWrite: true},
+		// Plugins and typos can't be told apart from writes
+		{args: "neat get pod foo", wantWrite: true, wantUncertain: true},
+		{args: "gett pods", wantWrite: true, wantUncertain: true},
+		// An unknown flag before the verb may take "get" as its value
+		{args: "--unknown get pods", wantWrite: true, wantUncertain: true},
+		{args: "--unknown=x get pods", wantWrite: false},
+		{args: "get pods --unknown", wantWrite: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			inv := ParseArgs(strings.Fields(tt.args))
+			if got := inv.IsWrite(); got != tt.wantWrite {
+				t.Errorf("IsWrite() = %v, want %v", got, tt.wantWrite)
+			}
+			if got := inv.IsUncertain(); got != tt.wantUncertain {
+				t.Errorf("IsUncertain() = %v, want %v", got, tt.wantUncertain)
+			}
+		})
+	}
+}
+
+func TestReplaceVerb(t *testing.T) {
+	inv := ParseArgs([]string{"--context", "prod", "touch", "deploy/foo"})
+	got := inv.ReplaceVerb("annotate")
+	want := []string{"--context", "prod", "annotate", "deploy/foo"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReplaceVerb() = %q, want %q", got, want)
+	}
+}
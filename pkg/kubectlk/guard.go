@@ -0,0 +1,137 @@
+package kubectlk
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/colors"
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/fatih/color"
+)
+
+// guard refuses writes to read-only clusters, shows a dry-run preview if wanted,
+// and asks for an interactive confirmation before a mutating verb is run against
+// a protected cluster. It returns an error if the command must not run.
+func guard(cluster model.Cluster, inv Invocation) error {
+	if cluster.ReadOnly && inv.IsWrite() {
+		if inv.IsUncertain() {
+			return fmt.Errorf("cluster %q is read-only, refusing to run %q as it is not known to be read-only", cluster.Name, strings.Join(inv.Args, " "))
+		}
+		return fmt.Errorf("cluster %q is read-only, refusing to run %q", cluster.Name, describeVerb(inv))
+	}
+
+	needsPreview := shouldPreview(cluster, inv)
+	// Like on read-only clusters, anything that isn't known to be a read is confirmed
+	needsConfirmation := cluster.Protected && inv.IsWrite() && !inv.Yes
+	if !needsPreview && !needsConfirmation {
+		return nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal is available to confirm %q on cluster %q, pass --yes to skip the confirmation", inv.Verb, cluster.Name)
+	}
+	defer tty.Close()
+	colors.ForTerminal()
+
+	if needsPreview {
+		previewText, err := preview(inv)
+		if err != nil {
+			fmt.Fprintf(tty, "%s failed to preview changes: %v\n", colors.Warning.Sprint("WARNING:"), err)
+		} else {
+			fmt.Fprint(tty, previewText)
+		}
+	}
+
+	if needsConfirmation {
+		return confirmProtected(tty, cluster, inv)
+	}
+	return confirm(tty, inv)
+}
+
+// confirm asks a simple yes/no question
+func confirm(tty *os.File, inv Invocation) error {
+	fmt.Fprintf(tty, "Continue with %s? [y/N]: ", colors.Bold.Sprint(inv.Verb))
+
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("aborted")
+	}
+}
+
+// confirmProtected makes the user type the name of the cluster
+func confirmProtected(tty *os.File, cluster model.Cluster, inv Invocation) error {
+	clusterName := clusterColor(cluster).Sprint(cluster.Name)
+	if cluster.Environment != "" {
+		clusterName += fmt.Sprintf(" (%s)", cluster.Environment)
+	}
+
+	command := describeVerb(inv)
+	if inv.IsUncertain() {
+		command = "kubectl " + strings.Join(inv.Args, " ")
+	}
+	fmt.Fprintf(tty, "%s You are about to run %s on a protected cluster\n", colors.Danger.Sprint("WARNING:"), colors.Bold.Sprint(command))
+	fmt.Fprintf(tty, "  cluster:   %s\n", clusterName)
+	fmt.Fprintf(tty, "  namespace: %s\n", describeNamespace(inv))
+	fmt.Fprintf(tty, "  resources: %s\n", describeResources(inv))
+	fmt.Fprintf(tty, "Type the cluster name to continue: ")
+
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	if strings.TrimSpace(answer) != cluster.Name {
+		return fmt.Errorf("aborted")
+	}
+	return nil
+}
+
+// describeVerb is the verb of an invocation, with its subcommand (e.g. "rollout restart")
+func describeVerb(inv Invocation) string {
+	if (readSubcommands[inv.Verb] != nil || inv.Verb == "set") && len(inv.Resources) > 0 {
+		return inv.Verb + " " + inv.Resources[0]
+	}
+	return inv.Verb
+}
+
+func clusterColor(cluster model.Cluster) *color.Color {
+	if c, ok := colors.Named(cluster.Color); ok {
+		return c
+	}
+	return colors.Bold
+}
+
+func describeNamespace(inv Invocation) string {
+	switch {
+	case inv.AllNamespaces:
+		return "<all namespaces>"
+	case inv.Namespace != "":
+		return inv.Namespace
+	default:
+		return "<default>"
+	}
+}
+
+func describeResources(inv Invocation) string {
+	var resources []string
+	resources = append(resources, inv.Resources...)
+	for _, filename := range inv.Filenames {
+		resources = append(resources, "-f "+filename)
+	}
+	if inv.Selector != "" {
+		resources = append(resources, "-l "+inv.Selector)
+	}
+
+	if len(resources) == 0 {
+		return "<none>"
+	}
+	return strings.Join(resources, " ")
+}
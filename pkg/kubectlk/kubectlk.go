@@ -0,0 +1,144 @@
+package kubectlk
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/history"
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/KevinWang15/k/pkg/utils"
+)
+
+// Run is invoked by the kubectl-k shell function. It applies k's own verbs and
+// safety checks, hands over to kubectl using the merged kubeconfig, and records
+// the invocation in the history. It exits with the exit code of kubectl.
+func Run(args []string) {
+	inv := ParseArgs(args)
+	config := utils.GetConfig()
+
+	// K_CLUSTER selects the context, unless the command line has one already
+	if clusterName := os.Getenv(consts.K_CLUSTER); clusterName != "" && inv.Context == "" {
+		inv = ParseArgs(append([]string{"--context", clusterName}, args...))
+		if _, ok := config.FindCluster(clusterName); !ok {
+			refuse(newRecord(clusterName, inv), fmt.Errorf("cluster %q (from %s) doesn't exist in %s", clusterName, consts.K_CLUSTER, utils.GetConfigPath()))
+		}
+	}
+
+	cluster, ok := resolveCluster(config, inv)
+	if ok {
+		if err := guard(cluster, inv); err != nil {
+			refuse(newRecord(cluster.Name, inv), err)
+		}
+	}
+
+	kubectlArgs := inv.Args
+	if inv.Verb == "touch" {
+		kubectlArgs = inv.ReplaceVerb("annotate")
+		kubectlArgs = append(kubectlArgs, fmt.Sprintf("touch=%d", rand.Int63()), "--overwrite")
+	}
+
+	record := newRecord(cluster.Name, inv)
+	record.ExitCode = runKubectl(kubectlArgs)
+	record.DurationMs = time.Since(record.Timestamp).Milliseconds()
+	appendHistory(record)
+
+	os.Exit(record.ExitCode)
+}
+
+func newRecord(cluster string, inv Invocation) history.Record {
+	return history.Record{
+		Timestamp: time.Now(),
+		User:      currentUser(),
+		Cluster:   cluster,
+		Namespace: inv.Namespace,
+		Verb:      inv.Verb,
+		Argv:      inv.Args,
+	}
+}
+
+// refuse records an invocation that k doesn't run, so that the attempts show up in
+// the history too, and exits
+func refuse(record history.Record, err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	record.ExitCode = 1
+	record.Error = err.Error()
+	appendHistory(record)
+	os.Exit(1)
+}
+
+func appendHistory(record history.Record) {
+	if err := history.Append(record); err != nil {
+		fmt.Fprintf(os.Stderr, "Warn: failed to record history: %v\n", err)
+	}
+}
+
+// resolveCluster finds the cluster an invocation targets, falling back to the
+// current-context of the merged kubeconfig (the first cluster).
+func resolveCluster(config model.Config, inv Invocation) (model.Cluster, bool) {
+	if inv.Context != "" {
+		return config.FindCluster(inv.Context)
+	}
+	if len(config.Clusters) > 0 {
+		return config.Clusters[0], true
+	}
+	return model.Cluster{}, false
+}
+
+// kubectlOutput runs kubectl against the merged kubeconfig and returns its stdout
+func kubectlOutput(args ...string) ([]byte, error) {
+	command := exec.Command("kubectl", append([]string{"--cache-dir=" + consts.K_CACHE_DIR}, args...)...)
+	command.Env = append(os.Environ(), "KUBECONFIG="+consts.K_KUBECONFIG_PATH)
+	command.Stderr = os.Stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w", strings.Join(args, " "), err)
+	}
+	return output, nil
+}
+
+// runKubectl runs kubectl attached to our terminal and returns its exit code
+func runKubectl(args []string) int {
+	command := exec.Command("kubectl", append([]string{"--cache-dir=" + consts.K_CACHE_DIR}, args...)...)
+	command.Env = append(os.Environ(), "KUBECONFIG="+consts.K_KUBECONFIG_PATH)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	// kubectl gets the signals from the terminal too, we only need to outlive it
+	// to record its exit code
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	err := command.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	default:
+		fmt.Fprintf(os.Stderr, "Error: failed to run kubectl: %v\n", err)
+		return 1
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,250 @@
+package kubectlk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/colors"
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/KevinWang15/k/pkg/watchchanges"
+)
+
+// previewVerbs are the verbs for which a server-side dry-run preview can be shown
+var previewVerbs = map[string]bool{
+	"apply":  true,
+	"patch":  true,
+	"scale":  true,
+	"delete": true,
+}
+
+// shouldPreview reports whether a dry-run preview is wanted for the invocation.
+// K_PREVIEW=1 enables it for a single invocation, K_PREVIEW=0 disables it even
+// on clusters that have it turned on.
+func shouldPreview(cluster model.Cluster, inv Invocation) bool {
+	if !previewVerbs[inv.Verb] || inv.Yes {
+		return false
+	}
+	for _, arg := range inv.Args {
+		if strings.HasPrefix(arg, "--dry-run") {
+			return false
+		}
+	}
+
+	switch os.Getenv(consts.K_PREVIEW) {
+	case "1", "true":
+		return true
+	case "0", "false":
+		return false
+	default:
+		return cluster.Preview
+	}
+}
+
+// preview runs the invocation with --dry-run=server and renders how it would change
+// the live objects.
+func preview(inv Invocation) (string, error) {
+	for _, filename := range inv.Filenames {
+		if filename == "-" {
+			return "", fmt.Errorf("cannot preview manifests read from stdin")
+		}
+	}
+
+	var changes []objectChange
+	var err error
+	if inv.Verb == "delete" {
+		changes, err = previewDelete(inv)
+	} else {
+		changes, err = previewUpdate(inv)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	for _, change := range changes {
+		diffText := watchchanges.RenderObjectDiff(change.live, change.dryRun)
+		if diffText == "" {
+			diffText = "(no changes)\n"
+		}
+		fmt.Fprintf(&result, "%s %s\n%s", colors.Warning.Sprint("PREVIEW:"), change.ref, diffText)
+	}
+	return result.String(), nil
+}
+
+type objectChange struct {
+	ref    string
+	live   map[string]interface{}
+	dryRun map[string]interface{}
+}
+
+// previewUpdate compares the objects returned by a server-side dry-run with their live versions
+func previewUpdate(inv Invocation) ([]objectChange, error) {
+	output, err := kubectlOutput(append(append([]string{}, inv.Args...), "--dry-run=server", "-o", "json")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []objectChange
+	for _, object := range listItems(output) {
+		ref := objectRef(object)
+		live, err := getObject(inv, ref, objectNamespace(object))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, objectChange{ref: ref, live: live, dryRun: object})
+	}
+	return changes, nil
+}
+
+// previewDelete asks the server which objects would be deleted and shows them as removed.
+// kubectl delete can only print their names, without namespaces, so the objects are
+// read with a get of the same selection.
+func previewDelete(inv Invocation) ([]objectChange, error) {
+	output, err := kubectlOutput(append(append([]string{}, inv.Args...), "--dry-run=server", "-o", "name")...)
+	if err != nil {
+		return nil, err
+	}
+	deleted := map[string]bool{}
+	for _, ref := range strings.Fields(string(output)) {
+		deleted[ref] = true
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+
+	output, err = kubectlOutput(append(getArgs(inv), "-o", "json")...)
+	if err != nil {
+		return nil, err
+	}
+	var changes []objectChange
+	for _, object := range listItems(output) {
+		if deleted[objectName(object)] {
+			changes = append(changes, objectChange{ref: objectRef(object), live: object})
+		}
+	}
+	return changes, nil
+}
+
+// deleteOnlyFlags are the flags of kubectl delete that kubectl get doesn't have,
+// and whether they take a value
+var deleteOnlyFlags = map[string]bool{
+	"--all":          false,
+	"--cascade":      false,
+	"--force":        false,
+	"--now":          false,
+	"--wait":         false,
+	"-i":             false,
+	"--interactive":  false,
+	"--grace-period": true,
+	"--timeout":      true,
+	"-o":             true,
+	"--output":       true,
+}
+
+// getArgs turns a delete invocation into a get of the objects it deletes
+func getArgs(inv Invocation) []string {
+	var args []string
+	for i := 0; i < len(inv.Args); i++ {
+		arg := inv.Args[i]
+		if i == inv.verbIndex {
+			args = append(args, "get")
+			continue
+		}
+		if i < inv.verbIndex {
+			args = append(args, arg)
+			continue
+		}
+		flag, _, hasValue := strings.Cut(arg, "=")
+		if takesValue, ok := deleteOnlyFlags[flag]; ok {
+			if takesValue && !hasValue {
+				i++
+			}
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// getObject fetches the live version of an object, nil if it doesn't exist
+func getObject(inv Invocation, ref string, namespace string) (map[string]interface{}, error) {
+	args := []string{"get", ref, "-o", "json", "--ignore-not-found"}
+	if inv.Context != "" {
+		args = append(args, "--context", inv.Context)
+	}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+
+	output, err := kubectlOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return nil, nil
+	}
+
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(output, &object); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ref, err)
+	}
+	return object, nil
+}
+
+// listItems returns the objects of a kubectl json output, flattening Lists
+func listItems(output []byte) []map[string]interface{} {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(output, &object); err != nil {
+		return nil
+	}
+
+	items, ok := object["items"].([]interface{})
+	if !ok {
+		return []map[string]interface{}{object}
+	}
+
+	var result []map[string]interface{}
+	for _, item := range items {
+		if itemObject, ok := item.(map[string]interface{}); ok {
+			result = append(result, itemObject)
+		}
+	}
+	return result
+}
+
+// objectRef builds a kind.version.group/name reference that kubectl get understands
+func objectRef(object map[string]interface{}) string {
+	kind, _ := object["kind"].(string)
+	apiVersion, _ := object["apiVersion"].(string)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+
+	resource := kind
+	if group, version, found := strings.Cut(apiVersion, "/"); found {
+		resource = fmt.Sprintf("%s.%s.%s", kind, version, group)
+	}
+	return strings.ToLower(resource) + "/" + name
+}
+
+// objectName is the name of an object as printed by kubectl -o name, e.g. deployment.apps/web
+func objectName(object map[string]interface{}) string {
+	kind, _ := object["kind"].(string)
+	apiVersion, _ := object["apiVersion"].(string)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+
+	resource := kind
+	if group, _, found := strings.Cut(apiVersion, "/"); found {
+		resource = kind + "." + group
+	}
+	return strings.ToLower(resource) + "/" + name
+}
+
+func objectNamespace(object map[string]interface{}) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	return namespace
+}
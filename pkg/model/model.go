@@ -15,17 +15,43 @@ type ClusterJSON struct {
 	ClientCertificateData    []byte          `json:"client-certificate-data,omitempty"`
 	ClientKeyData            []byte          `json:"client-key-data,omitempty"`
 	BearerToken              string          `json:"bearerToken"`
+	Environment              string          `json:"environment,omitempty"`
+	Protected                bool            `json:"protected,omitempty"`
+	Color                    string          `json:"color,omitempty"`
+	ReadOnly                 bool            `json:"readOnly,omitempty"`
+	ReadOnlyIdentity         *Identity       `json:"readOnlyIdentity,omitempty"`
+	Preview                  bool            `json:"preview,omitempty"`
 	ClusterData              json.RawMessage `json:"cluster,omitempty"`
 	UserData                 json.RawMessage `json:"user,omitempty"`
 }
 
 // Cluster represents a kubernetes cluster configuration
 type Cluster struct {
-	Name    string       `json:"name"`
+	Name string `json:"name"`
+
+	// Environment is a free-form label (e.g. "production") shown when k asks for confirmation
+	Environment string `json:"environment,omitempty"`
+	// Protected clusters require an interactive confirmation before mutating verbs
+	Protected bool `json:"protected,omitempty"`
+	// Color is the name of the color used to highlight the cluster (e.g. "red")
+	Color string `json:"color,omitempty"`
+	// ReadOnly clusters never get mutating verbs from k
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// ReadOnlyIdentity, if set on a ReadOnly cluster, is impersonated by the generated kubeconfig
+	ReadOnlyIdentity *Identity `json:"readOnlyIdentity,omitempty"`
+	// Preview shows a server-side dry-run diff and asks for confirmation before apply/delete
+	Preview bool `json:"preview,omitempty"`
+
 	Cluster *K8sCluster  `json:"cluster,omitempty"`
 	User    *K8sAuthInfo `json:"user,omitempty"`
 }
 
+// Identity is a user (and groups) to impersonate
+type Identity struct {
+	User   string   `json:"user"`
+	Groups []string `json:"groups,omitempty"`
+}
+
 // K8sCluster wraps the kubernetes Cluster type to handle the runtime.Object field
 type K8sCluster struct {
 	Server                   string                     `json:"server"`
@@ -56,8 +82,69 @@ type K8sAuthInfo struct {
 }
 
 type Config struct {
-	Shortcuts map[string]string `json:"shortcuts"`
-	Clusters  []Cluster         `json:"clusters"`
+	Shortcuts    map[string]string   `json:"shortcuts"`
+	Clusters     []Cluster           `json:"clusters"`
+	WatchChanges *WatchChangesConfig `json:"watchChanges,omitempty"`
+	// Theme is the color theme of every k command, "default" or "colorblind"
+	Theme string `json:"theme,omitempty"`
+}
+
+// WatchChangesConfig configures `k watch-changes`
+type WatchChangesConfig struct {
+	// IgnorePaths are removed from objects before they are diffed
+	IgnorePaths []PathRule `json:"ignorePaths,omitempty"`
+	// RedactPaths are hidden from the output, in addition to the data of Secrets
+	RedactPaths []PathRule `json:"redactPaths,omitempty"`
+	// Hooks are run on matching changes when watch-changes is started with --hooks
+	Hooks []Hook `json:"hooks,omitempty"`
+}
+
+// Hook runs a command, or posts to a webhook, with the JSON of every matching change
+type Hook struct {
+	Name  string    `json:"name"`
+	Match HookMatch `json:"match"`
+	// Exec is a command and its arguments, the change is written to its stdin
+	Exec []string `json:"exec,omitempty"`
+	// Webhook is posted the change
+	Webhook *Webhook `json:"webhook,omitempty"`
+	// Retries is the number of times a failed hook is retried, with exponential backoff
+	Retries int `json:"retries,omitempty"`
+	// MaxPerMinute caps how often the hook runs, changes over the limit are dropped
+	MaxPerMinute int `json:"maxPerMinute,omitempty"`
+}
+
+// HookMatch selects the changes a hook runs on, empty fields match everything
+type HookMatch struct {
+	Kind           string   `json:"kind,omitempty"`
+	Namespace      string   `json:"namespace,omitempty"`
+	Name           string   `json:"name,omitempty"`
+	NameRegex      string   `json:"nameRegex,omitempty"`
+	NamespaceRegex string   `json:"namespaceRegex,omitempty"`
+	EventTypes     []string `json:"eventTypes,omitempty"`
+	ChangedPaths   []string `json:"changedPaths,omitempty"`
+}
+
+// Webhook is an HTTP endpoint changes are posted to as JSON
+type Webhook struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// PathRule is a list of field paths (e.g. `status.conditions[*].lastHeartbeatTime`)
+// that applies to objects of one kind, or to every object if Kind is empty
+type PathRule struct {
+	Kind  string   `json:"kind,omitempty"`
+	Paths []string `json:"paths"`
+}
+
+// FindCluster returns the cluster with the given name
+func (c Config) FindCluster(name string) (Cluster, bool) {
+	for _, cluster := range c.Clusters {
+		if cluster.Name == name {
+			return cluster, true
+		}
+	}
+	return Cluster{}, false
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for Cluster
@@ -69,6 +156,12 @@ func (c *Cluster) UnmarshalJSON(data []byte) error {
 
 	// Copy the simple fields
 	c.Name = temp.Name
+	c.Environment = temp.Environment
+	c.Protected = temp.Protected
+	c.Color = temp.Color
+	c.ReadOnly = temp.ReadOnly
+	c.ReadOnlyIdentity = temp.ReadOnlyIdentity
+	c.Preview = temp.Preview
 
 	// Handle the Cluster field
 	if temp.ClusterData != nil {
@@ -3,7 +3,6 @@ package rc
 import (
 	"fmt"
 	"os"
-	"path"
 
 	"github.com/KevinWang15/k/pkg/consts"
 	"github.com/KevinWang15/k/pkg/model"
@@ -24,8 +23,8 @@ func Run() {
 
 	// We’ll store the single merged kubeconfig at ~/.k/config
 	// and keep all caches under ~/.k/cache
-	configPath := path.Join(consts.K_HOME_DIR, "config")
-	cacheDir := path.Join(consts.K_HOME_DIR, "cache")
+	configPath := consts.K_KUBECONFIG_PATH
+	cacheDir := consts.K_CACHE_DIR
 
 	err := os.MkdirAll(cacheDir, os.ModePerm)
 	if err != nil {
@@ -41,24 +40,21 @@ func Run() {
 		panic(err)
 	}
 
-	// Print the shell function: it sets KUBECONFIG to our single config file
-	// and always uses --cache-dir=... but defers context selection to the alias.
+	// Print the shell function: it injects the default namespace and hands over
+	// to `k kubectl`, which handles touch, protected clusters, and runs kubectl
+	// with our single config file and cache dir.
 	fmt.Printf(dedent.Dedent(`
 
 function kubectl-k() {
-    if [ "$1" = "touch" ]; then
-        set -- "annotate" "${@:2}" "touch=$RANDOM$RANDOM" "--overwrite"
-    fi
-
     # Default namespace injection if none specified
     if [[ "$@" != *"--all-namespaces"* && "$@" != *"--namespace"* && "$@" != *"-n"* && -n "$K_DEFAULT_NAMESPACE" ]]; then
         set -- -n "$K_DEFAULT_NAMESPACE" "$@"
     fi
 
-      KUBECONFIG=`+configPath+` kubectl --cache-dir='`+cacheDir) + `' $@
+    k kubectl "$@"
 }
 
-`)
+`))
 
 	// Helper for changing the default namespace
 	fmt.Printf(dedent.Dedent(`
@@ -72,12 +68,36 @@ function kns() {
     fi
 }
 
+function k() {
+    if [ "$1" = "use" ]; then
+        local exports
+        exports="$(command k "$@")" || return $?
+        eval "$exports"
+    else
+        command k "$@"
+    fi
+}
+
 function watch-changes() {
     cmdToRun="$(alias $1 | awk -F\' '{print $2}')"
     shift
-    cmdToRun="$cmdToRun $@"
+    # Arguments after -- are for k watch-changes rather than kubectl
+    local kArgs=""
+    local cluster="$(echo "$cmdToRun" | awk '{for (i = 1; i < NF; i++) if ($i == "--context") print $(i+1)}')"
+    if [ -n "$cluster" ]; then
+        kArgs=" --cluster $(printf '%%q' "$cluster")"
+    fi
+    while [ $# -gt 0 ] && [ "$1" != "--" ]; do
+        cmdToRun="$cmdToRun $1"
+        shift
+    done
+    [ "$1" = "--" ] && shift
+    while [ $# -gt 0 ]; do
+        kArgs="$kArgs $(printf '%%q' "$1")"
+        shift
+    done
     cmdToRun="$cmdToRun -ojson --output-watch-events --watch"
-    cmdToRun="while true; do $cmdToRun || break; done | k watch-changes"
+    cmdToRun="while true; do $cmdToRun || break; done | k watch-changes$kArgs"
 
     eval "$cmdToRun"
 }
@@ -115,6 +135,15 @@ func generateSingleKubeconfig(clusters []model.Cluster) *api.Config {
 		clusterAPI := c.Cluster.ToAPICluster()
 		userAPI := c.User.ToAPIAuthInfo()
 
+		// Read-only clusters can talk to the API server as a read-only identity
+		if c.ReadOnly && c.ReadOnlyIdentity != nil {
+			if userAPI == nil {
+				userAPI = api.NewAuthInfo()
+			}
+			userAPI.Impersonate = c.ReadOnlyIdentity.User
+			userAPI.ImpersonateGroups = c.ReadOnlyIdentity.Groups
+		}
+
 		// Use the cluster's name as the key in each map
 		kcfg.Clusters[c.Name] = clusterAPI
 		kcfg.AuthInfos[c.Name] = userAPI
@@ -0,0 +1,376 @@
+package revisions
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/consts"
+)
+
+// clusterScoped is the directory of the objects without a namespace
+const clusterScoped = "_"
+
+// maxRevisions is the number of revisions kept per object, from K_MAX_REVISIONS,
+// 0 means no limit
+var maxRevisions = (func() int {
+	env := os.Getenv(consts.K_MAX_REVISIONS)
+	if env == "" {
+		return 100
+	}
+	v, err := strconv.Atoi(env)
+	if err != nil {
+		panic(fmt.Errorf("failed to parse %s: %w", consts.K_MAX_REVISIONS, err))
+	}
+	return v
+})()
+
+// Revision is one observed state of an object, stored as a line of
+// ~/.k/revisions/<cluster>/<kind>[.<group>]/<namespace>/<name>
+type Revision struct {
+	// ID is the number of the revision, revisions stored before ids were kept are
+	// numbered by their line
+	ID        int             `json:"id,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	EventType string          `json:"eventType"`
+	UID       string          `json:"uid,omitempty"`
+	Object    json.RawMessage `json:"object"`
+}
+
+// Entry is a Revision along with its id
+type Entry struct {
+	ID int
+	Revision
+}
+
+// Object identifies the object revisions are stored for
+type Object struct {
+	Cluster string
+	Kind    string
+	// Group is the API group of Kind, "" for the core group
+	Group     string
+	Namespace string
+	Name      string
+}
+
+func (o Object) String() string {
+	if o.Namespace == "" {
+		return o.kindDir() + " " + o.Name
+	}
+	return o.kindDir() + " " + o.Namespace + "/" + o.Name
+}
+
+// kindDir is the kind qualified by its group, e.g. Deployment.apps, so that
+// same-named kinds of different groups are kept apart
+func (o Object) kindDir() string {
+	if o.Group == "" {
+		return o.Kind
+	}
+	return o.Kind + "." + o.Group
+}
+
+func (o Object) path() string {
+	namespace := o.Namespace
+	if namespace == "" {
+		namespace = clusterScoped
+	}
+	return path.Join(consts.K_REVISIONS_DIR, url.PathEscape(o.Cluster), url.PathEscape(o.kindDir()), url.PathEscape(namespace), url.PathEscape(o.Name))
+}
+
+// stored keeps track of the revisions of the objects appended to by this process,
+// so that files don't have to be read on every Append
+var (
+	storedMu sync.Mutex
+	stored   = map[string]*storedObject{}
+)
+
+type storedObject struct {
+	count  int
+	lastID int
+	// last is the hash of the last revision, unless it is a deletion
+	last [sha256.Size]byte
+}
+
+// hashRevision hashes the object of a revision, zero for deletions, after which
+// the same object is a new one
+func hashRevision(revision Revision) [sha256.Size]byte {
+	if revision.EventType == "DELETED" {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(revision.Object)
+}
+
+// Append adds a revision to the end of the file of the object, numbered after the
+// last one. A revision with the same object as the last one, e.g. when a new watch
+// lists objects that didn't change, is not added. Once the file has grown past
+// K_MAX_REVISIONS by a tenth, the oldest revisions are dropped.
+func Append(object Object, revision Revision) error {
+	storedMu.Lock()
+	defer storedMu.Unlock()
+
+	file := object.path()
+	state, ok := stored[file]
+	if !ok {
+		entries, err := Load(object)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		state = &storedObject{count: len(entries)}
+		if len(entries) > 0 {
+			last := entries[len(entries)-1]
+			state.lastID, state.last = last.ID, hashRevision(last.Revision)
+		}
+		stored[file] = state
+	}
+
+	hash := hashRevision(revision)
+	if hash != ([sha256.Size]byte{}) && hash == state.last {
+		return nil
+	}
+
+	revision.ID = state.lastID + 1
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision: %w", err)
+	}
+
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create revisions dir: %w", err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open revisions file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write revisions file %s: %w", file, err)
+	}
+	state.lastID, state.last, state.count = revision.ID, hash, state.count+1
+
+	if maxRevisions > 0 && state.count > maxRevisions+maxRevisions/10 {
+		if err := trim(object, maxRevisions); err != nil {
+			return err
+		}
+		state.count = maxRevisions
+	}
+	return nil
+}
+
+// trim keeps only the last revisions of an object
+func trim(object Object, keep int) error {
+	entries, err := Load(object)
+	if err != nil {
+		return err
+	}
+	if len(entries) > keep {
+		entries = entries[len(entries)-keep:]
+	}
+
+	var content bytes.Buffer
+	for _, entry := range entries {
+		entry.Revision.ID = entry.ID
+		data, err := json.Marshal(entry.Revision)
+		if err != nil {
+			return fmt.Errorf("failed to marshal revision: %w", err)
+		}
+		content.Write(append(data, '\n'))
+	}
+
+	file := object.path()
+	temporary := file + ".tmp"
+	if err := os.WriteFile(temporary, content.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write revisions file %s: %w", temporary, err)
+	}
+	if err := os.Rename(temporary, file); err != nil {
+		return fmt.Errorf("failed to replace revisions file %s: %w", file, err)
+	}
+	return nil
+}
+
+// Load reads every revision of an object. Lines that cannot be parsed are skipped.
+// Revisions without an id are numbered by their line.
+func Load(object Object) ([]Entry, error) {
+	file := object.path()
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no revisions of %s on cluster %s: %w", object, object.Cluster, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open revisions file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for id := 1; scanner.Scan(); id++ {
+		var revision Revision
+		if err := json.Unmarshal(scanner.Bytes(), &revision); err != nil {
+			continue
+		}
+		if revision.ID != 0 {
+			id = revision.ID
+		}
+		entries = append(entries, Entry{ID: id, Revision: revision})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read revisions file %s: %w", file, err)
+	}
+	return entries, nil
+}
+
+// Get returns the revision of an object with the given id
+func Get(object Object, id int) (Entry, error) {
+	entries, err := Load(object)
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("no revision %d of %s", id, object)
+}
+
+// shortNames are the kubectl short names of common kinds
+var shortNames = map[string]string{
+	"cm":     "configmap",
+	"cj":     "cronjob",
+	"deploy": "deployment",
+	"ds":     "daemonset",
+	"ep":     "endpoints",
+	"hpa":    "horizontalpodautoscaler",
+	"ing":    "ingress",
+	"no":     "node",
+	"ns":     "namespace",
+	"pdb":    "poddisruptionbudget",
+	"po":     "pod",
+	"pv":     "persistentvolume",
+	"pvc":    "persistentvolumeclaim",
+	"rs":     "replicaset",
+	"sa":     "serviceaccount",
+	"sts":    "statefulset",
+	"svc":    "service",
+}
+
+// Find resolves an object written like kubectl does (e.g. deploy/foo) among the
+// stored ones, without access to the cluster. The kind may be a kind, a plural,
+// a short name or a unique prefix. An empty namespace matches any namespace, as
+// long as only one of them has an object with that name.
+func Find(cluster, kindAndName, namespace string) (Object, error) {
+	kind, name, found := strings.Cut(kindAndName, "/")
+	if !found || kind == "" || name == "" {
+		return Object{}, fmt.Errorf("invalid object %q, expected kind/name (e.g. deploy/foo)", kindAndName)
+	}
+
+	clusterDir := path.Join(consts.K_REVISIONS_DIR, url.PathEscape(cluster))
+	kinds, err := readDirNames(clusterDir)
+	if err != nil {
+		return Object{}, err
+	}
+	if len(kinds) == 0 {
+		return Object{}, fmt.Errorf("no revisions stored for cluster %s", cluster)
+	}
+	resolvedKind, err := resolveKind(kind, kinds)
+	if err != nil {
+		return Object{}, err
+	}
+
+	object := Object{Cluster: cluster, Name: name}
+	object.Kind, object.Group, _ = strings.Cut(resolvedKind, ".")
+	if namespace != "" {
+		object.Namespace = namespace
+		return object, nil
+	}
+
+	namespaces, err := readDirNames(path.Join(clusterDir, url.PathEscape(resolvedKind)))
+	if err != nil {
+		return Object{}, err
+	}
+	var matches []string
+	for _, ns := range namespaces {
+		if _, err := os.Stat(path.Join(clusterDir, url.PathEscape(resolvedKind), url.PathEscape(ns), url.PathEscape(name))); err == nil {
+			matches = append(matches, ns)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Object{}, fmt.Errorf("no revisions of %s %s on cluster %s", resolvedKind, name, cluster)
+	case 1:
+		if matches[0] != clusterScoped {
+			object.Namespace = matches[0]
+		}
+		return object, nil
+	default:
+		return Object{}, fmt.Errorf("%s %s exists in several namespaces (%s), pass -n", resolvedKind, name, strings.Join(matches, ", "))
+	}
+}
+
+// resolveKind finds the kind directory (Kind or Kind.group) a kind written on the
+// command line refers to. It may be qualified by its group too, e.g. deploy.apps.
+func resolveKind(kind string, kinds []string) (string, error) {
+	wanted, wantedGroup, qualified := strings.Cut(strings.ToLower(kind), ".")
+	if full, ok := shortNames[wanted]; ok {
+		wanted = full
+	}
+
+	var exact, prefixed []string
+	for _, candidate := range kinds {
+		candidateKind, candidateGroup, _ := strings.Cut(strings.ToLower(candidate), ".")
+		if qualified && candidateGroup != wantedGroup {
+			continue
+		}
+		if candidateKind == wanted || candidateKind+"s" == wanted || candidateKind+"es" == wanted {
+			exact = append(exact, candidate)
+		} else if strings.HasPrefix(candidateKind, wanted) {
+			prefixed = append(prefixed, candidate)
+		}
+	}
+	if len(exact) == 0 {
+		exact = prefixed
+	}
+	switch len(exact) {
+	case 0:
+		return "", fmt.Errorf("no revisions of kind %q stored", kind)
+	case 1:
+		return exact[0], nil
+	default:
+		return "", fmt.Errorf("kind %q is ambiguous: %s", kind, strings.Join(exact, ", "))
+	}
+}
+
+// readDirNames lists the unescaped names in a directory, sorted
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
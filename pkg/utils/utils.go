@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/KevinWang15/k/pkg/consts"
 	"github.com/KevinWang15/k/pkg/model"
@@ -54,3 +55,17 @@ func EnsureKHomeDir() {
 		panic(fmt.Errorf("create dir %q error: %s", consts.K_HOME_DIR, err.Error()))
 	}
 }
+
+// ParseTime accepts either a duration relative to now (e.g. "2h") or an absolute
+// time in RFC 3339 or YYYY-MM-DD format.
+func ParseTime(value string) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a duration like 2h or a time like 2006-01-02T15:04:05", value)
+}
@@ -0,0 +1,361 @@
+package watchchanges
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// manifest is a desired object read from the --baseline directory
+type manifest struct {
+	file      string
+	kind      string
+	namespace string
+	name      string
+	object    map[string]interface{}
+	value     string
+	// seen is set once an object was compared with the manifest
+	seen bool
+}
+
+var (
+	// manifests are keyed by kind/namespace/name. Those without a namespace match
+	// an object of that kind and name in any namespace.
+	manifests map[string]*manifest
+
+	// drifts is the last projection shown for every object with a manifest, ""
+	// once it was deleted, so that only changes in drift are shown
+	drifts map[string]string
+
+	// watchedScopes are the kinds, and kinds in namespaces, of the objects seen so
+	// far, to tell which manifests the watch would have listed
+	watchedScopes map[[2]string]bool
+
+	// missingReported is set once the manifests without an object were reported
+	missingReported bool
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// loadBaseline reads the manifests of --baseline, with the same fields ignored
+// and redacted as in the watched objects
+func loadBaseline() {
+	manifests, drifts, watchedScopes, missingReported = nil, map[string]string{}, map[[2]string]bool{}, false
+	if options.Baseline == "" {
+		return
+	}
+
+	manifests = map[string]*manifest{}
+	err := filepath.WalkDir(options.Baseline, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != options.Baseline && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+			// Templates (e.g. of Helm charts) are not manifests yet, they are skipped
+			if err := loadManifests(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Warn: %v, skipping it\n", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load baseline: %v\n", err)
+		os.Exit(1)
+	}
+	if len(manifests) == 0 {
+		fmt.Fprintf(os.Stderr, "Warn: no manifests found in %s\n", options.Baseline)
+	}
+}
+
+func loadManifests(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documentSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if object == nil {
+			continue
+		}
+
+		objects := []interface{}{object}
+		if items, ok := object["items"].([]interface{}); ok && strings.HasSuffix(fmt.Sprint(object["kind"]), "List") {
+			objects = items
+		}
+		for _, item := range objects {
+			if typed, ok := item.(map[string]interface{}); ok {
+				addManifest(file, typed)
+			}
+		}
+	}
+	return nil
+}
+
+func addManifest(file string, object map[string]interface{}) {
+	kind, _ := object["kind"].(string)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	if kind == "" || name == "" {
+		fmt.Fprintf(os.Stderr, "Warn: skipping a manifest without a kind or name in %s\n", file)
+		return
+	}
+	namespace, _ := metadata["namespace"].(string)
+
+	key := driftKey(kind, namespace, name)
+	if existing, ok := manifests[key]; ok {
+		fmt.Fprintf(os.Stderr, "Warn: %s %s/%s is in both %s and %s, using the latter\n", kind, namespaceOrPlaceholder(namespace), name, existing.file, file)
+	}
+
+	// The apiVersion depends on how the object is read rather than on the object
+	delete(object, "apiVersion")
+	delete(object, "status")
+	moveStringData(kind, object)
+	stripIgnoredFields(object)
+	applyIgnoreRules(kind, object)
+	protectSecrets(kind, object)
+	manifests[key] = &manifest{file: file, kind: kind, namespace: namespace, name: name, object: object, value: mustMarshalJson(object)}
+}
+
+// moveStringData encodes the stringData of a Secret into its data, as the API server does
+func moveStringData(kind string, object map[string]interface{}) {
+	stringData, ok := object["stringData"].(map[string]interface{})
+	if !strings.EqualFold(kind, "Secret") || !ok {
+		return
+	}
+	data, ok := object["data"].(map[string]interface{})
+	if !ok {
+		data = map[string]interface{}{}
+		object["data"] = data
+	}
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+	}
+	delete(object, "stringData")
+}
+
+func driftKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func findManifest(kind, namespace, name string) *manifest {
+	if m, ok := manifests[driftKey(kind, namespace, name)]; ok {
+		return m
+	}
+	return manifests[driftKey(kind, "", name)]
+}
+
+// checkDrift compares an object with its manifest, and shows a DRIFTED change with
+// the diff from the manifest to the object when they differ, or a SYNCED change
+// once they no longer do. Objects without a manifest are not shown.
+func checkDrift(c change, object map[string]interface{}, show func(change)) {
+	watchedScopes[[2]string{c.kind, ""}] = true
+	watchedScopes[[2]string{c.kind, c.namespace}] = true
+
+	m := findManifest(c.kind, c.namespace, c.name)
+	if m == nil {
+		return
+	}
+	m.seen = true
+
+	key := driftKey(c.kind, c.namespace, c.name)
+	previous, seen := drifts[key]
+	c.oldValue = m.value
+	c.message = m.file
+
+	if c.eventType == "DELETED" {
+		drifts[key] = ""
+		c.eventType = "DRIFTED"
+		show(c)
+		return
+	}
+
+	current := mustMarshalJson(project(m.object, object))
+	drifts[key] = current
+	switch {
+	case current == m.value:
+		if seen && previous != m.value {
+			c.eventType = "SYNCED"
+			c.newValue = current
+			show(c)
+		}
+	case !seen || previous != current:
+		c.eventType = "DRIFTED"
+		c.newValue = current
+		show(c)
+	}
+}
+
+// reportMissing shows a DRIFTED change for every manifest that no object was seen
+// for, once the initial list of objects is complete. inScope tells whether the
+// watch would have listed the object of a manifest.
+func reportMissing(at time.Time, inScope func(m *manifest) bool, show func(change, map[string]interface{})) {
+	if manifests == nil || missingReported {
+		return
+	}
+	missingReported = true
+
+	for _, key := range sortedKeys(manifests) {
+		m := manifests[key]
+		if m.seen || !inScope(m) || !options.Filter.matches(m.kind, m.namespace, m.name) {
+			continue
+		}
+		drifts[key] = ""
+		show(change{
+			time:      at,
+			eventType: "DRIFTED",
+			kind:      m.kind,
+			namespace: m.namespace,
+			name:      m.name,
+			// The manifest key stands in for the uid of the object that doesn't exist
+			uid:      key,
+			oldValue: m.value,
+			message:  m.file,
+			missing:  true,
+		}, m.object)
+	}
+}
+
+// seenInScope is the scope of reportMissing when the watched resources are not
+// known: the kinds seen, in the namespaces seen for them
+func seenInScope(m *manifest) bool {
+	return watchedScopes[[2]string{m.kind, m.namespace}]
+}
+
+// showMissing triggers the hooks for a missing object and shows it. Like the objects
+// of the initial list, those missing from it don't trigger hooks.
+func showMissing(c change, object map[string]interface{}) {
+	if !listing {
+		triggerHooks(c, object)
+	}
+	if options.Filter.matchesChange(c, object) {
+		emit(c)
+	}
+}
+
+// project keeps the parts of the live object that the manifest sets, so that
+// fields populated by the API server (defaults, status, metadata) are not
+// reported as drift. Fields of the manifest missing from the live object are
+// left out, and extra list items are kept, so that both show up in the diff.
+func project(desired, live interface{}) interface{} {
+	switch desiredTyped := desired.(type) {
+	case map[string]interface{}:
+		liveTyped, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		result := map[string]interface{}{}
+		for key, desiredChild := range desiredTyped {
+			if liveChild, ok := liveTyped[key]; ok {
+				result[key] = project(desiredChild, liveChild)
+			}
+		}
+		return result
+	case []interface{}:
+		liveTyped, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		if result, ok := projectByName(desiredTyped, liveTyped); ok {
+			return result
+		}
+		result := make([]interface{}, len(liveTyped))
+		for i, liveItem := range liveTyped {
+			if i < len(desiredTyped) {
+				result[i] = project(desiredTyped[i], liveItem)
+			} else {
+				result[i] = liveItem
+			}
+		}
+		return result
+	}
+
+	// Numbers written as strings, or the other way round (e.g. cpu: 1 and "1")
+	if live != nil && desired != nil && fmt.Sprint(desired) == fmt.Sprint(live) {
+		return desired
+	}
+	return live
+}
+
+// projectByName matches list items by their name, like containers and volumes,
+// which the API server may keep in another order
+func projectByName(desired, live []interface{}) ([]interface{}, bool) {
+	if len(desired) == 0 || len(live) == 0 {
+		return nil, false
+	}
+
+	desiredByName := map[string]interface{}{}
+	for _, item := range desired {
+		name, ok := itemName(item)
+		if !ok {
+			return nil, false
+		}
+		desiredByName[name] = item
+	}
+
+	var matched, extra []interface{}
+	byName := map[string]interface{}{}
+	for _, item := range live {
+		name, ok := itemName(item)
+		if !ok {
+			return nil, false
+		}
+		if desiredItem, ok := desiredByName[name]; ok {
+			byName[name] = project(desiredItem, item)
+		} else {
+			extra = append(extra, item)
+		}
+	}
+
+	// In the order of the manifest, so that a different order alone is no drift
+	for _, item := range desired {
+		name, _ := itemName(item)
+		if projected, ok := byName[name]; ok {
+			matched = append(matched, projected)
+		}
+	}
+	return append(matched, extra...), true
+}
+
+func itemName(item interface{}) (string, bool) {
+	typed, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := typed["name"].(string)
+	return name, ok
+}
+
+// renderDrift renders the diff from a manifest to the live object
+func renderDrift(c change) string {
+	if c.missing {
+		return fmt.Sprintf("  missing, desired by %s", c.message)
+	}
+	if c.newValue == "" {
+		return fmt.Sprintf("  deleted, but desired by %s", c.message)
+	}
+	var result strings.Builder
+	fmt.Fprintf(&result, "  desired by %s\n", c.message)
+	result.WriteString(renderChange(c.oldValue, c.newValue))
+	return result.String()
+}
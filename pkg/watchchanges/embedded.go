@@ -0,0 +1,86 @@
+package watchchanges
+
+import (
+	"encoding/json"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// expandEmbedded replaces the JSON and YAML documents embedded in the data of
+// ConfigMaps and in annotations (e.g. kubectl.kubernetes.io/last-applied-configuration)
+// by their content, so that they are diffed field by field rather than as one
+// gigantic line. Other multi-line values are split into their lines. Secrets are
+// left alone, as their expanded documents would escape the redact rules.
+func expandEmbedded(kind string, object map[string]interface{}) {
+	if !options.ExpandEmbedded || strings.EqualFold(kind, "Secret") {
+		return
+	}
+
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		expandValues(metadata["annotations"])
+	}
+	if strings.EqualFold(kind, "ConfigMap") {
+		expandValues(object["data"])
+	}
+}
+
+// expandForDiff expands the embedded documents of a marshaled object for a diff.
+// Only diffs are expanded, what is tracked, stored, sent to hooks or printed as
+// a body is the actual object.
+func expandForDiff(value string) string {
+	if !options.ExpandEmbedded || value == "" {
+		return value
+	}
+	object, ok := unmarshalValue(value).(map[string]interface{})
+	if !ok {
+		return value
+	}
+	kind, _ := object["kind"].(string)
+	expandEmbedded(kind, object)
+	return mustMarshalJson(object)
+}
+
+func expandValues(values interface{}) {
+	if typed, ok := values.(map[string]interface{}); ok {
+		for key, value := range typed {
+			typed[key] = expandValue(value)
+		}
+	}
+}
+
+func expandValue(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil {
+			return parsed
+		}
+	} else if strings.Contains(trimmed, "\n") {
+		// Any text is valid YAML, only block maps and lists are expanded. Flow
+		// documents are left out, as the parser silently drops what follows them
+		// (e.g. in INI files).
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(s), &parsed); err == nil {
+			switch parsed.(type) {
+			case map[string]interface{}, []interface{}:
+				return parsed
+			}
+		}
+	}
+	if !strings.Contains(trimmed, "\n") {
+		return value
+	}
+
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	result := make([]interface{}, len(lines))
+	for i, line := range lines {
+		result[i] = line
+	}
+	return result
+}
@@ -0,0 +1,228 @@
+package watchchanges
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/colors"
+)
+
+// listKeys are the fields used to match list items between two versions of an
+// object, in order of preference. Items are matched by index if none of them
+// identifies every item of the list.
+var listKeys = []string{"name", "type", "containerPort"}
+
+// pathElement is one step of the path to a changed field
+type pathElement struct {
+	// key is the key in a map, or the "name=value" identifying a list item
+	key string
+	// index is the position in a list, -1 for map keys and list items matched by key
+	index int
+	// byKey is set for list items matched by key
+	byKey bool
+}
+
+// fieldChange is a field that was added, removed or changed
+type fieldChange struct {
+	path     []pathElement
+	oldValue interface{}
+	newValue interface{}
+	inOld    bool
+	inNew    bool
+}
+
+// diffFields walks two object trees and returns the fields that differ
+func diffFields(oldValue, newValue interface{}) []fieldChange {
+	return appendFieldChanges(nil, nil, oldValue, newValue)
+}
+
+func appendFieldChanges(changes []fieldChange, path []pathElement, oldValue, newValue interface{}) []fieldChange {
+	child := func(element pathElement) []pathElement {
+		return append(append([]pathElement{}, path...), element)
+	}
+
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		newTyped, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		for _, key := range unionKeys(oldTyped, newTyped) {
+			oldChild, inOld := oldTyped[key]
+			newChild, inNew := newTyped[key]
+			element := pathElement{key: key, index: -1}
+			if inOld && inNew {
+				changes = appendFieldChanges(changes, child(element), oldChild, newChild)
+			} else {
+				changes = append(changes, fieldChange{path: child(element), oldValue: oldChild, newValue: newChild, inOld: inOld, inNew: inNew})
+			}
+		}
+		return changes
+	case []interface{}:
+		newTyped, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+
+		if key := commonListKey(oldTyped, newTyped); key != "" {
+			oldItems, newItems := itemsByKey(oldTyped, key), itemsByKey(newTyped, key)
+			for _, id := range unionKeys(oldItems, newItems) {
+				oldChild, inOld := oldItems[id]
+				newChild, inNew := newItems[id]
+				element := pathElement{key: key + "=" + id, index: -1, byKey: true}
+				if inOld && inNew {
+					changes = appendFieldChanges(changes, child(element), oldChild, newChild)
+				} else {
+					changes = append(changes, fieldChange{path: child(element), oldValue: oldChild, newValue: newChild, inOld: inOld, inNew: inNew})
+				}
+			}
+			return changes
+		}
+
+		for i := 0; i < len(oldTyped) || i < len(newTyped); i++ {
+			element := pathElement{index: i}
+			switch {
+			case i >= len(newTyped):
+				changes = append(changes, fieldChange{path: child(element), oldValue: oldTyped[i], inOld: true})
+			case i >= len(oldTyped):
+				changes = append(changes, fieldChange{path: child(element), newValue: newTyped[i], inNew: true})
+			default:
+				changes = appendFieldChanges(changes, child(element), oldTyped[i], newTyped[i])
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes = append(changes, fieldChange{path: path, oldValue: oldValue, newValue: newValue, inOld: true, inNew: true})
+	}
+	return changes
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// commonListKey finds a key in listKeys that identifies every item of both lists
+func commonListKey(oldItems, newItems []interface{}) string {
+	for _, key := range listKeys {
+		if identifiesItems(oldItems, key) && identifiesItems(newItems, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+func identifiesItems(items []interface{}, key string) bool {
+	if len(items) == 0 {
+		return true
+	}
+	seen := map[string]bool{}
+	for _, item := range items {
+		id, ok := itemID(item, key)
+		if !ok || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+func itemID(item interface{}, key string) (string, bool) {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	switch value := object[key].(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+func itemsByKey(items []interface{}, key string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, item := range items {
+		id, _ := itemID(item, key)
+		result[id] = item
+	}
+	return result
+}
+
+var simpleKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// formatPath renders a path like spec.containers[name=app].ports[0].containerPort
+func formatPath(path []pathElement) string {
+	var result strings.Builder
+	for _, element := range path {
+		switch {
+		case element.index >= 0:
+			fmt.Fprintf(&result, "[%d]", element.index)
+		case element.byKey:
+			fmt.Fprintf(&result, "[%s]", element.key)
+		case simpleKey.MatchString(element.key):
+			if result.Len() > 0 {
+				result.WriteByte('.')
+			}
+			result.WriteString(element.key)
+		default:
+			fmt.Fprintf(&result, "[%s]", strconv.Quote(element.key))
+		}
+	}
+	return result.String()
+}
+
+// formatValue renders a value compactly, leaving simple strings unquoted unless
+// they could be mistaken for another type (e.g. "true" or "3")
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok && s != "" && !strings.ContainsAny(s, " \t\n\"'{}[],:") && !json.Valid([]byte(s)) {
+		return s
+	}
+	return mustMarshalCompactJson(value)
+}
+
+// renderFieldDiff renders the changes between two marshaled objects, one line per field
+func renderFieldDiff(oldValue, newValue string) string {
+	var result strings.Builder
+	for _, c := range diffFields(unmarshalValue(oldValue), unmarshalValue(newValue)) {
+		path := formatPath(c.path)
+		switch {
+		case !c.inOld:
+			result.WriteString(colors.Added.Sprintf("+ %s: %s", path, formatValue(c.newValue)) + "\n")
+		case !c.inNew:
+			result.WriteString(colors.Removed.Sprintf("- %s: %s", path, formatValue(c.oldValue)) + "\n")
+		default:
+			fmt.Fprintf(&result, "  %s: %s → %s\n", path, colors.Removed.Sprint(formatValue(c.oldValue)), colors.Added.Sprint(formatValue(c.newValue)))
+		}
+	}
+	return result.String()
+}
+
+// ChangedFieldPaths returns the paths of the fields that differ between two
+// objects, written like in the field diffs of watch-changes
+func ChangedFieldPaths(oldObject, newObject interface{}) []string {
+	var paths []string
+	for _, c := range diffFields(oldObject, newObject) {
+		paths = append(paths, formatPath(c.path))
+	}
+	return paths
+}
@@ -0,0 +1,161 @@
+package watchchanges
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Filter selects the changes to show, on the client side. Empty fields match everything.
+type Filter struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// EventTypes are the event types to show, e.g. MODIFIED
+	EventTypes []string
+	// NameRegex and NamespaceRegex match the name and namespace of objects
+	NameRegex      string
+	NamespaceRegex string
+	// LabelSelector and AnnotationSelector are label selectors (e.g. "app=foo,tier!=db")
+	// matched against the labels and the annotations of objects
+	LabelSelector      string
+	AnnotationSelector string
+	// ChangedPaths only show modifications of one of these field paths (e.g.
+	// spec.template.spec.containers[*].image)
+	ChangedPaths []string
+
+	compiled *compiledFilter
+}
+
+type compiledFilter struct {
+	nameRegex          *regexp.Regexp
+	namespaceRegex     *regexp.Regexp
+	labelSelector      labels.Selector
+	annotationSelector labels.Selector
+	changedPaths       []fieldPath
+}
+
+// Compile checks the filter, it has to be called before the filter is used
+func (f *Filter) Compile() error {
+	compiled := &compiledFilter{}
+	var err error
+
+	if f.NameRegex != "" {
+		if compiled.nameRegex, err = regexp.Compile(f.NameRegex); err != nil {
+			return fmt.Errorf("invalid name regex: %w", err)
+		}
+	}
+	if f.NamespaceRegex != "" {
+		if compiled.namespaceRegex, err = regexp.Compile(f.NamespaceRegex); err != nil {
+			return fmt.Errorf("invalid namespace regex: %w", err)
+		}
+	}
+	if f.LabelSelector != "" {
+		if compiled.labelSelector, err = labels.Parse(f.LabelSelector); err != nil {
+			return fmt.Errorf("invalid label selector: %w", err)
+		}
+	}
+	if f.AnnotationSelector != "" {
+		if compiled.annotationSelector, err = labels.Parse(f.AnnotationSelector); err != nil {
+			return fmt.Errorf("invalid annotation selector: %w", err)
+		}
+	}
+	for _, path := range f.ChangedPaths {
+		parsed, err := parseFieldPath(path)
+		if err != nil {
+			return fmt.Errorf("invalid changed path: %w", err)
+		}
+		compiled.changedPaths = append(compiled.changedPaths, parsed)
+	}
+
+	f.compiled = compiled
+	return nil
+}
+
+// matches selects objects by their identity, before they are tracked
+func (f Filter) matches(kind, namespace, name string) bool {
+	if f.Kind != "" && !strings.EqualFold(f.Kind, kind) {
+		return false
+	}
+	if f.Namespace != "" && f.Namespace != namespace {
+		return false
+	}
+	if f.Name != "" && f.Name != name {
+		return false
+	}
+	if f.compiled != nil && f.compiled.nameRegex != nil && !f.compiled.nameRegex.MatchString(name) {
+		return false
+	}
+	if f.compiled != nil && f.compiled.namespaceRegex != nil && !f.compiled.namespaceRegex.MatchString(namespace) {
+		return false
+	}
+	return true
+}
+
+// matchesEventType selects events by type
+func (f Filter) matchesEventType(eventType string) bool {
+	if len(f.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range f.EventTypes {
+		if strings.EqualFold(t, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesChange selects the changes to show. Labels and annotations can change,
+// so they are matched against the latest state of the object, after it is tracked.
+func (f Filter) matchesChange(c change, object map[string]interface{}) bool {
+	if !f.matchesEventType(c.eventType) {
+		return false
+	}
+	if f.compiled == nil {
+		return true
+	}
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if f.compiled.labelSelector != nil && !f.compiled.labelSelector.Matches(stringMap(metadata["labels"])) {
+		return false
+	}
+	if f.compiled.annotationSelector != nil && !f.compiled.annotationSelector.Matches(stringMap(metadata["annotations"])) {
+		return false
+	}
+
+	if len(f.compiled.changedPaths) > 0 {
+		// An object that is back in sync is shown whichever fields had drifted
+		if c.eventType == "SYNCED" {
+			return true
+		}
+		// The diff of a drift is from the manifest to the object
+		if c.eventType != "MODIFIED" && c.eventType != "DRIFTED" {
+			return false
+		}
+		oldObject, newObject := unmarshalValue(c.oldValue), unmarshalValue(c.newValue)
+		for _, path := range f.compiled.changedPaths {
+			if !reflect.DeepEqual(path.collect(oldObject), path.collect(newObject)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// stringMap converts labels or annotations to labels.Set
+func stringMap(value interface{}) labels.Set {
+	result := labels.Set{}
+	if m, ok := value.(map[string]interface{}); ok {
+		for key, v := range m {
+			if s, ok := v.(string); ok {
+				result[key] = s
+			}
+		}
+	}
+	return result
+}
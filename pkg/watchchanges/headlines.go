@@ -0,0 +1,328 @@
+package watchchanges
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/colors"
+)
+
+// What is shown for modifications of kinds with headlines
+const (
+	// HeadlinesAbove shows the headlines above the diff
+	HeadlinesAbove = "above"
+	// HeadlinesOnly shows the headlines instead of the diff, when there are any
+	HeadlinesOnly = "only"
+	// HeadlinesOff shows only the diff
+	HeadlinesOff = "off"
+)
+
+// workloadKinds are the kinds whose replicas are summarized
+var workloadKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"ReplicaSet":  true,
+	"DaemonSet":   true,
+}
+
+// headlines summarizes a modification in a few lines, e.g. condition transitions,
+// rollouts, restarts and image changes, which are hard to read from the raw diff
+// of status.conditions or containerStatuses
+func headlines(kind, oldValue, newValue string) []string {
+	oldObject, _ := unmarshalValue(oldValue).(map[string]interface{})
+	newObject, _ := unmarshalValue(newValue).(map[string]interface{})
+	if oldObject == nil || newObject == nil {
+		return nil
+	}
+
+	var result []string
+	result = append(result, imageHeadlines(oldObject, newObject)...)
+	if workloadKinds[kind] {
+		result = append(result, replicaHeadlines(kind, oldObject, newObject)...)
+	}
+	if kind == "Pod" {
+		result = append(result, podHeadlines(oldObject, newObject)...)
+	}
+	result = append(result, conditionHeadlines(oldObject, newObject)...)
+	return result
+}
+
+// renderHeadlines renders headlines, one per line
+func renderHeadlines(lines []string) string {
+	var result strings.Builder
+	for _, line := range lines {
+		result.WriteString(colors.Bold.Sprint("▸ "+line) + "\n")
+	}
+	return result.String()
+}
+
+// renderModification renders a modification of an object with its headlines,
+// according to --headlines
+func renderModification(kind, oldValue, newValue string) string {
+	if options.Headlines == HeadlinesOff {
+		return renderChange(oldValue, newValue)
+	}
+	lines := headlines(kind, oldValue, newValue)
+	if len(lines) == 0 {
+		return renderChange(oldValue, newValue)
+	}
+	if options.Headlines == HeadlinesOnly {
+		return renderHeadlines(lines)
+	}
+	return renderHeadlines(lines) + renderChange(oldValue, newValue)
+}
+
+// podSpec finds the pod spec of pods, pod templates and cron jobs
+func podSpec(object map[string]interface{}) map[string]interface{} {
+	paths := [][]string{
+		{"spec"},
+		{"spec", "template", "spec"},
+		{"spec", "jobTemplate", "spec", "template", "spec"},
+	}
+	for _, path := range paths {
+		if spec, ok := nested(object, path...).(map[string]interface{}); ok {
+			if _, ok := spec["containers"]; ok {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
+func imageHeadlines(oldObject, newObject map[string]interface{}) []string {
+	oldImages, newImages := containerImages(podSpec(oldObject)), containerImages(podSpec(newObject))
+
+	var result []string
+	for _, name := range sortedKeys(newImages) {
+		oldImage, ok := oldImages[name]
+		if ok && oldImage != newImages[name] {
+			result = append(result, fmt.Sprintf("image %s: %s → %s", name, oldImage, newImages[name]))
+		}
+	}
+	return result
+}
+
+// containerImages maps the names of the containers and init containers of a pod spec to their images
+func containerImages(spec map[string]interface{}) map[string]string {
+	images := map[string]string{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := spec[field].([]interface{})
+		for _, container := range containers {
+			typed, _ := container.(map[string]interface{})
+			name, _ := typed["name"].(string)
+			image, _ := typed["image"].(string)
+			if name != "" {
+				images[name] = image
+			}
+		}
+	}
+	return images
+}
+
+func replicaHeadlines(kind string, oldObject, newObject map[string]interface{}) []string {
+	var result []string
+	if kind != "DaemonSet" {
+		if oldDesired, newDesired := scalarAt(oldObject, "spec", "replicas"), scalarAt(newObject, "spec", "replicas"); oldDesired != nil && newDesired != nil && oldDesired != newDesired {
+			result = append(result, fmt.Sprintf("scaled %v → %v", oldDesired, newDesired))
+		}
+	}
+
+	// DaemonSets count scheduled pods rather than replicas, and ReplicaSets don't
+	// count updated replicas, as they are all of the same revision
+	type replicaCount struct{ field, label string }
+	desiredField := "replicas"
+	counts := []replicaCount{{"updatedReplicas", "updated"}, {"readyReplicas", "ready"}}
+	switch kind {
+	case "DaemonSet":
+		desiredField = "desiredNumberScheduled"
+		counts = []replicaCount{{"updatedNumberScheduled", "updated"}, {"numberReady", "ready"}}
+	case "ReplicaSet":
+		counts = []replicaCount{{"readyReplicas", "ready"}, {"availableReplicas", "available"}}
+	}
+	changed := false
+	for _, field := range []string{desiredField, counts[0].field, counts[1].field} {
+		if scalarAt(oldObject, "status", field) != scalarAt(newObject, "status", field) {
+			changed = true
+		}
+	}
+	if !changed {
+		return result
+	}
+
+	count := func(field string) interface{} {
+		if value := scalarAt(newObject, "status", field); value != nil {
+			return value
+		}
+		return 0
+	}
+	desired := scalarAt(newObject, "spec", "replicas")
+	if desired == nil || kind == "DaemonSet" {
+		desired = count(desiredField)
+	}
+	var parts []string
+	for _, c := range counts {
+		parts = append(parts, fmt.Sprintf("%v/%v %s", count(c.field), desired, c.label))
+	}
+	result = append(result, "replicas "+strings.Join(parts, ", "))
+	return result
+}
+
+func podHeadlines(oldObject, newObject map[string]interface{}) []string {
+	var result []string
+	if oldPhase, newPhase := scalarAt(oldObject, "status", "phase"), scalarAt(newObject, "status", "phase"); oldPhase != nil && newPhase != nil && oldPhase != newPhase {
+		result = append(result, fmt.Sprintf("phase: %v → %v", oldPhase, newPhase))
+	}
+
+	oldStatuses, newStatuses := containerStatuses(oldObject), containerStatuses(newObject)
+	for _, name := range sortedKeys(newStatuses) {
+		newStatus := newStatuses[name]
+		oldStatus, ok := oldStatuses[name]
+		if !ok {
+			continue
+		}
+
+		oldRestarts, _ := oldStatus["restartCount"].(float64)
+		newRestarts, _ := newStatus["restartCount"].(float64)
+		if newRestarts > oldRestarts {
+			line := fmt.Sprintf("container %s restarted (#%v)", name, newRestarts)
+			if terminated, ok := nested(newStatus, "lastState", "terminated").(map[string]interface{}); ok {
+				line = fmt.Sprintf("container %s restarted (#%v, %s)", name, newRestarts, describeTermination(terminated))
+			}
+			result = append(result, line)
+		}
+
+		if reason, ok := nested(newStatus, "state", "waiting", "reason").(string); ok && reason != nested(oldStatus, "state", "waiting", "reason") {
+			result = append(result, fmt.Sprintf("container %s waiting: %s", name, reason))
+		}
+		if terminated, ok := nested(newStatus, "state", "terminated").(map[string]interface{}); ok && nested(oldStatus, "state", "terminated") == nil {
+			result = append(result, fmt.Sprintf("container %s terminated (%s)", name, describeTermination(terminated)))
+		}
+	}
+	return result
+}
+
+func describeTermination(terminated map[string]interface{}) string {
+	description := fmt.Sprintf("exit code %v", terminated["exitCode"])
+	if reason, ok := terminated["reason"].(string); ok && reason != "" {
+		description = fmt.Sprintf("reason: %s, %s", reason, description)
+	}
+	return description
+}
+
+// containerStatuses maps the names of the containers and init containers of a pod to their statuses
+func containerStatuses(object map[string]interface{}) map[string]map[string]interface{} {
+	statuses := map[string]map[string]interface{}{}
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		list, _ := nested(object, "status", field).([]interface{})
+		for _, status := range list {
+			typed, _ := status.(map[string]interface{})
+			if name, ok := typed["name"].(string); ok {
+				statuses[name] = typed
+			}
+		}
+	}
+	return statuses
+}
+
+// conditionHeadlines shows the conditions that appeared or were removed, and those
+// whose status or reason changed
+func conditionHeadlines(oldObject, newObject map[string]interface{}) []string {
+	oldConditions, newConditions := conditions(oldObject), conditions(newObject)
+
+	var result []string
+	for _, conditionType := range sortedKeys(newConditions) {
+		newCondition := newConditions[conditionType]
+		newStatus := scalar(newCondition["status"])
+		if newStatus == nil {
+			continue
+		}
+		newReason, _ := newCondition["reason"].(string)
+
+		oldCondition, ok := oldConditions[conditionType]
+		if !ok {
+			result = append(result, fmt.Sprintf("%s: %v", conditionType, newStatus)+describeReason(newReason))
+			continue
+		}
+		oldStatus := scalar(oldCondition["status"])
+		if oldStatus == nil {
+			continue
+		}
+		oldReason, _ := oldCondition["reason"].(string)
+		switch {
+		case oldStatus != newStatus:
+			result = append(result, fmt.Sprintf("%s: %v → %v", conditionType, oldStatus, newStatus)+describeReason(newReason))
+		case oldReason != newReason:
+			result = append(result, fmt.Sprintf("%s: %v (reason: %s → %s)", conditionType, newStatus, reasonOrNone(oldReason), reasonOrNone(newReason)))
+		}
+	}
+	for _, conditionType := range sortedKeys(oldConditions) {
+		if _, ok := newConditions[conditionType]; !ok {
+			result = append(result, fmt.Sprintf("%s removed", conditionType))
+		}
+	}
+	return result
+}
+
+func describeReason(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (reason: %s)", reason)
+}
+
+func reasonOrNone(reason string) string {
+	if reason == "" {
+		return "none"
+	}
+	return reason
+}
+
+// conditions maps the types of the conditions of an object to the conditions
+func conditions(object map[string]interface{}) map[string]map[string]interface{} {
+	result := map[string]map[string]interface{}{}
+	list, _ := nested(object, "status", "conditions").([]interface{})
+	for _, condition := range list {
+		typed, _ := condition.(map[string]interface{})
+		if conditionType, ok := typed["type"].(string); ok {
+			result[conditionType] = typed
+		}
+	}
+	return result
+}
+
+// nested returns the value at a path of map keys, or nil
+func nested(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		typed, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = typed[key]
+	}
+	return value
+}
+
+// scalarAt returns the value at a path of map keys, nil if it is missing or is
+// not a scalar, so that it can be compared with ==
+func scalarAt(value interface{}, keys ...string) interface{} {
+	return scalar(nested(value, keys...))
+}
+
+// scalar returns a value, or nil if it is a map or a list, which can't be compared with ==
+func scalar(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil
+	}
+	return value
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,187 @@
+package watchchanges
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/KevinWang15/k/pkg/utils"
+	"golang.org/x/time/rate"
+)
+
+const (
+	hookQueueSize = 100
+	hookTimeout   = 30 * time.Second
+)
+
+// hook is a model.Hook ready to run. Changes are queued and handled one at a time
+// by a goroutine per hook, so that slow hooks do not hold up the watch.
+type hook struct {
+	model.Hook
+	filter  Filter
+	limiter *rate.Limiter
+	queue   chan change
+}
+
+var (
+	hooks     []*hook
+	hooksDone sync.WaitGroup
+)
+
+// startHooks starts the hooks of config.json, if --hooks is set
+func startHooks() {
+	if !options.Hooks {
+		return
+	}
+
+	config := utils.GetConfig().WatchChanges
+	if config == nil || len(config.Hooks) == 0 {
+		fmt.Fprintf(os.Stderr, "Warn: --hooks is set but there are no hooks in the configuration\n")
+		return
+	}
+
+	for _, h := range config.Hooks {
+		if len(h.Exec) == 0 && h.Webhook == nil {
+			panic(fmt.Errorf("hook %q has neither exec nor webhook", h.Name))
+		}
+
+		started := &hook{
+			Hook: h,
+			filter: Filter{
+				Kind:           h.Match.Kind,
+				Namespace:      h.Match.Namespace,
+				Name:           h.Match.Name,
+				NameRegex:      h.Match.NameRegex,
+				NamespaceRegex: h.Match.NamespaceRegex,
+				EventTypes:     h.Match.EventTypes,
+				ChangedPaths:   h.Match.ChangedPaths,
+			},
+			queue: make(chan change, hookQueueSize),
+		}
+		if err := started.filter.Compile(); err != nil {
+			panic(fmt.Errorf("invalid match of hook %q: %w", h.Name, err))
+		}
+		if h.MaxPerMinute > 0 {
+			started.limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(h.MaxPerMinute)), h.MaxPerMinute)
+		}
+
+		hooksDone.Add(1)
+		go started.run()
+		hooks = append(hooks, started)
+	}
+}
+
+// triggerHooks queues a change for the hooks it matches. It is called for every
+// change, before --filter and the other options that only select the output.
+func triggerHooks(c change, object map[string]interface{}) {
+	for _, h := range hooks {
+		if !h.filter.matches(c.kind, c.namespace, c.name) || !h.filter.matchesChange(c, object) {
+			continue
+		}
+		if h.limiter != nil && !h.limiter.Allow() {
+			fmt.Fprintf(os.Stderr, "Warn: hook %s is over %d runs per minute, skipping %s %s/%s\n", h.Name, h.MaxPerMinute, c.kind, namespaceOrPlaceholder(c.namespace), c.name)
+			continue
+		}
+		select {
+		case h.queue <- c:
+		default:
+			fmt.Fprintf(os.Stderr, "Warn: hook %s is falling behind, skipping %s %s/%s\n", h.Name, c.kind, namespaceOrPlaceholder(c.namespace), c.name)
+		}
+	}
+}
+
+// waitHooks lets the queued changes go through the hooks before exiting
+func waitHooks() {
+	for _, h := range hooks {
+		close(h.queue)
+	}
+	hooksDone.Wait()
+}
+
+func (h *hook) run() {
+	defer hooksDone.Done()
+	for c := range h.queue {
+		record := newJSONLRecord(c)
+		record.Old, record.New = unmarshalValue(c.oldValue), unmarshalValue(c.newValue)
+		payload := []byte(mustMarshalCompactJson(record))
+
+		// Each sink is retried on its own, so that a failing webhook doesn't run the
+		// command again
+		if len(h.Exec) > 0 {
+			h.retry(c, "command", func() error { return h.runExec(c, payload) })
+		}
+		if h.Webhook != nil {
+			h.retry(c, "webhook", func() error { return h.postWebhook(payload) })
+		}
+	}
+}
+
+// retry calls fn until it succeeds or Retries is exhausted, with exponential backoff
+func (h *hook) retry(c change, sink string, fn func() error) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return
+		}
+		if attempt >= h.Retries {
+			fmt.Fprintf(os.Stderr, "Error: %s of hook %s failed for %s %s/%s: %v\n", sink, h.Name, c.kind, namespaceOrPlaceholder(c.namespace), c.name, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// runExec runs the command of the hook once for a change
+func (h *hook) runExec(c change, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	command := exec.CommandContext(ctx, h.Exec[0], h.Exec[1:]...)
+	command.Stdin = bytes.NewReader(payload)
+	command.Stdout = os.Stderr
+	command.Stderr = os.Stderr
+	command.Env = append(os.Environ(),
+		"K_HOOK="+h.Name,
+		"K_EVENT_TYPE="+c.eventType,
+		"K_EVENT_KIND="+c.kind,
+		"K_EVENT_NAMESPACE="+c.namespace,
+		"K_EVENT_NAME="+c.name,
+	)
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+// postWebhook sends a change to the webhook of the hook once
+func (h *hook) postWebhook(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range h.Webhook.Headers {
+		request.Header.Set(key, os.ExpandEnv(value))
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
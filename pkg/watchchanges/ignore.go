@@ -0,0 +1,86 @@
+package watchchanges
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/KevinWang15/k/pkg/utils"
+)
+
+// ignoreRules are loaded when watch-changes starts, see loadIgnoreRules
+var ignoreRules []pathRule
+
+// pathRule is a parsed model.PathRule
+type pathRule struct {
+	kind  string
+	paths []fieldPath
+}
+
+func (r pathRule) appliesTo(kind string) bool {
+	return r.kind == "" || strings.EqualFold(r.kind, kind)
+}
+
+// loadIgnoreRules reads the ignore rules from config.json and from K_IGNORE_PATHS,
+// a comma separated list of paths, each optionally prefixed by a kind
+// (e.g. "metadata.generation,Node:status.conditions[*].lastHeartbeatTime").
+func loadIgnoreRules() {
+	var rules []model.PathRule
+	if config := utils.GetConfig().WatchChanges; config != nil {
+		rules = append(rules, config.IgnorePaths...)
+	}
+
+	rules = append(rules, parsePathRulesEnv(os.Getenv(consts.K_IGNORE_PATHS))...)
+
+	var err error
+	if ignoreRules, err = parsePathRules(rules); err != nil {
+		panic(fmt.Errorf("failed to parse ignore paths: %w", err))
+	}
+}
+
+// parsePathRulesEnv parses a comma separated list of paths, each optionally prefixed by a kind
+func parsePathRulesEnv(env string) []model.PathRule {
+	var rules []model.PathRule
+	for _, entry := range strings.Split(env, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, path, found := strings.Cut(entry, ":")
+		if !found {
+			kind, path = "", entry
+		}
+		rules = append(rules, model.PathRule{Kind: kind, Paths: []string{path}})
+	}
+	return rules
+}
+
+func parsePathRules(rules []model.PathRule) ([]pathRule, error) {
+	var result []pathRule
+	for _, rule := range rules {
+		parsed := pathRule{kind: rule.Kind}
+		for _, path := range rule.Paths {
+			fieldPath, err := parseFieldPath(path)
+			if err != nil {
+				return nil, err
+			}
+			parsed.paths = append(parsed.paths, fieldPath)
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// applyIgnoreRules removes the ignored fields from the object
+func applyIgnoreRules(kind string, object map[string]interface{}) {
+	for _, rule := range ignoreRules {
+		if !rule.appliesTo(kind) {
+			continue
+		}
+		for _, path := range rule.paths {
+			path.remove(object)
+		}
+	}
+}
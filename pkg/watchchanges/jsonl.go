@@ -0,0 +1,160 @@
+package watchchanges
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonlRecord is what `-o jsonl` prints for every change, one per line
+type jsonlRecord struct {
+	Timestamp string           `json:"timestamp"`
+	Type      string           `json:"type"`
+	Kind      string           `json:"kind"`
+	Namespace string           `json:"namespace,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	UID       string           `json:"uid,omitempty"`
+	Message   string           `json:"message,omitempty"`
+	Headlines []string         `json:"headlines,omitempty"`
+	Patch     []patchOperation `json:"patch,omitempty"`
+	Old       interface{}      `json:"old,omitempty"`
+	New       interface{}      `json:"new,omitempty"`
+}
+
+// patchOperation is an RFC 6902 JSON Patch operation. Value is kept as raw JSON
+// so that a null value is still written out for add and replace.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func newPatchOperation(op string, path string, value interface{}) patchOperation {
+	return patchOperation{Op: op, Path: path, Value: json.RawMessage(mustMarshalCompactJson(value))}
+}
+
+func newJSONLRecord(c change) jsonlRecord {
+	record := jsonlRecord{
+		Timestamp: c.time.Format(time.RFC3339Nano),
+		Type:      c.eventType,
+		Kind:      c.kind,
+		Namespace: c.namespace,
+		Name:      c.name,
+		UID:       c.uid,
+		Message:   c.message,
+	}
+
+	oldObject, newObject := unmarshalValue(c.oldValue), unmarshalValue(c.newValue)
+	switch {
+	case c.eventType == "MODIFIED":
+		record.Patch = createPatch(oldObject, newObject)
+		if options.Headlines != HeadlinesOff {
+			record.Headlines = headlines(c.kind, c.oldValue, c.newValue)
+		}
+	case c.eventType == "DRIFTED" && newObject != nil:
+		record.Patch = createPatch(oldObject, newObject)
+	case c.eventType == "DELETED" && options.OnDelete == OnDeleteDiff && oldObject != nil:
+		record.Patch = createPatch(oldObject, newObject)
+	}
+	if options.IncludeObjects {
+		record.Old, record.New = oldObject, newObject
+	}
+	return record
+}
+
+// printJSONL prints a change as a single line of JSON
+func printJSONL(c change) {
+	fmt.Println(mustMarshalCompactJson(newJSONLRecord(c)))
+}
+
+func unmarshalValue(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	var result interface{}
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		panic(fmt.Errorf("failed to unmarshal value: %w", err))
+	}
+	return result
+}
+
+func mustMarshalCompactJson(value interface{}) string {
+	return marshalJson(value, "")
+}
+
+// createPatch computes a JSON Patch turning oldValue into newValue. Lists are
+// compared element by element, with trailing elements added or removed.
+func createPatch(oldValue, newValue interface{}) []patchOperation {
+	operations := []patchOperation{}
+	return appendPatch(operations, "", oldValue, newValue)
+}
+
+func appendPatch(operations []patchOperation, path string, oldValue, newValue interface{}) []patchOperation {
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		newTyped, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(oldTyped)+len(newTyped))
+		for key := range oldTyped {
+			keys = append(keys, key)
+		}
+		for key := range newTyped {
+			if _, exists := oldTyped[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			childPath := path + "/" + escapePointer(key)
+			oldChild, inOld := oldTyped[key]
+			newChild, inNew := newTyped[key]
+			switch {
+			case !inNew:
+				operations = append(operations, patchOperation{Op: "remove", Path: childPath})
+			case !inOld:
+				operations = append(operations, newPatchOperation("add", childPath, newChild))
+			default:
+				operations = appendPatch(operations, childPath, oldChild, newChild)
+			}
+		}
+		return operations
+	case []interface{}:
+		newTyped, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+
+		common := len(oldTyped)
+		if len(newTyped) < common {
+			common = len(newTyped)
+		}
+		for i := 0; i < common; i++ {
+			operations = appendPatch(operations, path+"/"+strconv.Itoa(i), oldTyped[i], newTyped[i])
+		}
+		for i := len(oldTyped) - 1; i >= common; i-- {
+			operations = append(operations, patchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(newTyped); i++ {
+			operations = append(operations, newPatchOperation("add", path+"/-", newTyped[i]))
+		}
+		return operations
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		operations = append(operations, newPatchOperation("replace", path, newValue))
+	}
+	return operations
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,85 @@
+package watchchanges
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCreatePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldValue string
+		newValue string
+		want     string
+	}{
+		{
+			name:     "no change",
+			oldValue: `{"spec": {"replicas": 1}}`,
+			newValue: `{"spec": {"replicas": 1}}`,
+			want:     `[]`,
+		},
+		{
+			name:     "replace a value",
+			oldValue: `{"spec": {"replicas": 1}}`,
+			newValue: `{"spec": {"replicas": 2}}`,
+			want:     `[{"op": "replace", "path": "/spec/replicas", "value": 2}]`,
+		},
+		{
+			name:     "add and remove fields, in key order",
+			oldValue: `{"metadata": {"labels": {"b": "1", "c": "1"}}}`,
+			newValue: `{"metadata": {"labels": {"a": "1", "b": "1"}}}`,
+			want:     `[{"op": "add", "path": "/metadata/labels/a", "value": "1"}, {"op": "remove", "path": "/metadata/labels/c"}]`,
+		},
+		{
+			name:     "escape keys",
+			oldValue: `{"metadata": {"annotations": {}}}`,
+			newValue: `{"metadata": {"annotations": {"example.com/a~b": "x"}}}`,
+			want:     `[{"op": "add", "path": "/metadata/annotations/example.com~1a~0b", "value": "x"}]`,
+		},
+		{
+			name:     "change a list element",
+			oldValue: `{"containers": [{"image": "a"}, {"image": "b"}]}`,
+			newValue: `{"containers": [{"image": "a"}, {"image": "c"}]}`,
+			want:     `[{"op": "replace", "path": "/containers/1/image", "value": "c"}]`,
+		},
+		{
+			name:     "append to a list",
+			oldValue: `{"args": ["a"]}`,
+			newValue: `{"args": ["a", "b", "c"]}`,
+			want:     `[{"op": "add", "path": "/args/-", "value": "b"}, {"op": "add", "path": "/args/-", "value": "c"}]`,
+		},
+		{
+			name:     "shorten a list from the end",
+			oldValue: `{"args": ["a", "b", "c"]}`,
+			newValue: `{"args": ["a"]}`,
+			want:     `[{"op": "remove", "path": "/args/2"}, {"op": "remove", "path": "/args/1"}]`,
+		},
+		{
+			name:     "change the type of a value",
+			oldValue: `{"data": {"a": "1"}}`,
+			newValue: `{"data": ["1"]}`,
+			want:     `[{"op": "replace", "path": "/data", "value": ["1"]}]`,
+		},
+		{
+			name:     "replace the whole object",
+			oldValue: `{"a": 1}`,
+			newValue: `null`,
+			want:     `[{"op": "replace", "path": "", "value": null}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := createPatch(mustUnmarshal(t, tt.oldValue), mustUnmarshal(t, tt.newValue))
+
+			data, err := json.Marshal(patch)
+			if err != nil {
+				t.Fatalf("failed to marshal patch: %v", err)
+			}
+			if got, want := mustUnmarshal(t, string(data)), mustUnmarshal(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("createPatch() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package watchchanges
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+	// minWatchDuration is how long a watch has to last for the retry delay to be reset
+	minWatchDuration = 10 * time.Second
+)
+
+// NativeOptions configures RunNative
+type NativeOptions struct {
+	Options
+
+	// Resource is a comma separated list of resources (e.g. "deploy,rs,po") or categories (e.g. "all")
+	Resource      string
+	Name          string
+	Namespace     string
+	AllNamespaces bool
+	Selector      string
+	// Owner (e.g. "deploy/foo") limits the output to that object and the objects it owns
+	Owner string
+}
+
+// nativeEvent is an event received by one of the watchers
+type nativeEvent struct {
+	object     map[string]interface{}
+	eventType  string
+	receivedAt time.Time
+	// listed is set on the events of a list, rather than of the watch
+	listed bool
+}
+
+// RunNative watches resources with client-go instead of reading `kubectl get --watch`
+// output from stdin. It resumes from the last resourceVersion when a watch is
+// interrupted, and re-lists quietly when that resourceVersion is too old.
+// When several resources are watched, their events are shown in the order they arrive.
+func RunNative(opts NativeOptions) {
+	setOptions(opts.Options)
+	startSummary(time.Now())
+
+	if _, ok := utils.GetConfig().FindCluster(opts.Cluster); !ok {
+		fmt.Fprintf(os.Stderr, "Error: cluster %q doesn't exist in %s\n", opts.Cluster, utils.GetConfigPath())
+		os.Exit(1)
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: consts.K_KUBECONFIG_PATH},
+		&clientcmd.ConfigOverrides{CurrentContext: opts.Cluster},
+	)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		panic(fmt.Errorf("failed to load kubeconfig for cluster %q: %w", opts.Cluster, err))
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		panic(fmt.Errorf("failed to create discovery client: %w", err))
+	}
+	cachedDiscovery := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscovery), cachedDiscovery)
+
+	mappings, err := resolveResources(mapper, restmapper.NewDiscoveryCategoryExpander(cachedDiscovery), opts.Resource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		panic(fmt.Errorf("failed to create dynamic client: %w", err))
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = os.Getenv(consts.K_DEFAULT_NAMESPACE)
+	}
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			panic(fmt.Errorf("failed to get the namespace of cluster %q: %w", opts.Cluster, err))
+		}
+	}
+	resourceClient := func(mapping *meta.RESTMapping) dynamic.ResourceInterface {
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace && !opts.AllNamespaces {
+			return dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+		}
+		return dynamicClient.Resource(mapping.Resource)
+	}
+
+	var owners *ownerFilter
+	if opts.Owner != "" {
+		owners, err = newOwnerFilter(context.Background(), mapper, resourceClient, opts.Owner)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	listOptions := metav1.ListOptions{LabelSelector: opts.Selector}
+	if opts.Name != "" {
+		listOptions.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.Name).String()
+	}
+
+	events := make(chan nativeEvent)
+	listed := make(chan struct{}, len(mappings))
+	for _, mapping := range mappings {
+		w := &watcher{
+			client:      resourceClient(mapping),
+			listOptions: listOptions,
+			known:       map[string]map[string]interface{}{},
+			events:      events,
+			listed:      listed,
+		}
+		go w.run(context.Background())
+	}
+
+	openRecorder()
+	for remaining := len(mappings); ; {
+		select {
+		case <-listed:
+			// The owned objects can't be told from the manifests, so they are not reported
+			if remaining--; remaining == 0 && owners == nil {
+				listing = true
+				reportMissing(time.Now(), nativeScope(opts, mappings, namespace), showMissing)
+				listing = false
+			}
+		case event := <-events:
+			recordEvent(map[string]interface{}{"type": event.eventType, "object": event.object}, event.receivedAt)
+			listing = event.listed
+
+			if owners == nil {
+				processObject(event.object, event.eventType, event.receivedAt)
+				continue
+			}
+			for _, ownedEvent := range owners.filter(event) {
+				processObject(ownedEvent.object, ownedEvent.eventType, ownedEvent.receivedAt)
+			}
+		}
+	}
+}
+
+// nativeScope tells whether RunNative lists the object of a manifest
+func nativeScope(opts NativeOptions, mappings []*meta.RESTMapping, namespace string) func(m *manifest) bool {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		selector = labels.Nothing()
+	}
+	return func(m *manifest) bool {
+		if opts.Name != "" && m.name != opts.Name {
+			return false
+		}
+		metadata, _ := m.object["metadata"].(map[string]interface{})
+		if !selector.Matches(stringMap(metadata["labels"])) {
+			return false
+		}
+		for _, mapping := range mappings {
+			if mapping.GroupVersionKind.Kind != m.kind {
+				continue
+			}
+			namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+			return !namespaced || opts.AllNamespaces || m.namespace == "" || m.namespace == namespace
+		}
+		return false
+	}
+}
+
+// resolveResources resolves a comma separated list of resources and categories
+func resolveResources(mapper meta.RESTMapper, categories restmapper.CategoryExpander, resources string) ([]*meta.RESTMapping, error) {
+	var mappings []*meta.RESTMapping
+	seen := map[schema.GroupVersionResource]bool{}
+	add := func(mapping *meta.RESTMapping) {
+		if !seen[mapping.Resource] {
+			seen[mapping.Resource] = true
+			mappings = append(mappings, mapping)
+		}
+	}
+
+	for _, resource := range strings.Split(resources, ",") {
+		resource = strings.TrimSpace(resource)
+		if resource == "" {
+			continue
+		}
+
+		if groupResources, ok := categories.Expand(resource); ok {
+			for _, groupResource := range groupResources {
+				mapping, err := resolveResource(mapper, groupResource.String())
+				if err != nil {
+					return nil, err
+				}
+				add(mapping)
+			}
+			continue
+		}
+
+		mapping, err := resolveResource(mapper, resource)
+		if err != nil {
+			return nil, err
+		}
+		add(mapping)
+	}
+
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("no resource to watch in %q", resources)
+	}
+	return mappings, nil
+}
+
+// resolveResource turns what the user typed (e.g. "deploy", "deployments.apps") into a REST mapping
+func resolveResource(mapper meta.RESTMapper, resource string) (*meta.RESTMapping, error) {
+	var gvr schema.GroupVersionResource
+	if fullySpecified, groupResource := schema.ParseResourceArg(resource); fullySpecified != nil {
+		gvr = *fullySpecified
+	} else {
+		gvr = groupResource.WithVersion("")
+	}
+
+	gvk, err := mapper.KindFor(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource %q: %w", resource, err)
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource %q: %w", resource, err)
+	}
+	return mapping, nil
+}
+
+// watcher keeps one list+watch going, sending its events to a channel
+type watcher struct {
+	client      dynamic.ResourceInterface
+	listOptions metav1.ListOptions
+
+	// resourceVersion to resume from, "" means we need to list again
+	resourceVersion string
+	// known holds the identity of every object, keyed by uid, to find out which
+	// objects went away while we were re-listing. Only the identity is kept, so that
+	// --max-tracked bounds the memory used for the objects themselves.
+	known map[string]map[string]interface{}
+
+	events chan<- nativeEvent
+	// listed is sent to once the first list is done, then set to nil
+	listed chan<- struct{}
+}
+
+func (w *watcher) run(ctx context.Context) {
+	retryDelay := minRetryDelay
+	for {
+		started := time.Now()
+		err := w.listAndWatch(ctx)
+		switch {
+		case err == nil && (w.resourceVersion == "" || time.Since(started) >= minWatchDuration):
+			// Re-list after a 410 Gone, or resume a watch that went on for a while, right away
+			retryDelay = minRetryDelay
+			continue
+		case err == nil:
+			// A server or proxy that closes watches right away would otherwise be flooded
+			err = fmt.Errorf("the watch was closed after %s", time.Since(started).Round(time.Millisecond))
+		}
+
+		fmt.Fprintf(os.Stderr, "Warn: %v, retrying in %s\n", err, retryDelay)
+		time.Sleep(retryDelay)
+		retryDelay *= 2
+		if retryDelay > maxRetryDelay {
+			retryDelay = maxRetryDelay
+		}
+	}
+}
+
+// listAndWatch watches until the server closes the watch. It returns nil when the
+// watch can simply be resumed (or the list redone after a 410 Gone).
+func (w *watcher) listAndWatch(ctx context.Context) error {
+	if w.resourceVersion == "" {
+		if err := w.list(ctx); err != nil {
+			return err
+		}
+	}
+
+	options := w.listOptions
+	options.ResourceVersion = w.resourceVersion
+	options.AllowWatchBookmarks = true
+	watchInterface, err := w.client.Watch(ctx, options)
+	if err != nil {
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			w.resourceVersion = ""
+			return nil
+		}
+		return fmt.Errorf("failed to watch: %w", err)
+	}
+	defer watchInterface.Stop()
+
+	for event := range watchInterface.ResultChan() {
+		switch event.Type {
+		case watch.Error:
+			err := apierrors.FromObject(event.Object)
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				w.resourceVersion = ""
+				return nil
+			}
+			return fmt.Errorf("watch error: %w", err)
+		case watch.Bookmark:
+			if object, ok := event.Object.(*unstructured.Unstructured); ok {
+				w.resourceVersion = object.GetResourceVersion()
+			}
+		case watch.Added, watch.Modified, watch.Deleted:
+			object, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			w.resourceVersion = object.GetResourceVersion()
+			w.process(string(object.GetUID()), object.Object, string(event.Type), false)
+		}
+	}
+	return nil
+}
+
+// list replaces our view of the world with a fresh list. Objects we already know
+// are sent as ADDED again, and processObject only prints them if they changed.
+func (w *watcher) list(ctx context.Context) error {
+	list, err := w.client.List(ctx, w.listOptions)
+	if err != nil {
+		return fmt.Errorf("failed to list: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, item := range list.Items {
+		uid := string(item.GetUID())
+		seen[uid] = true
+		w.process(uid, item.Object, string(watch.Added), true)
+	}
+	for uid, object := range w.known {
+		if !seen[uid] {
+			w.process(uid, object, string(watch.Deleted), true)
+		}
+	}
+
+	w.resourceVersion = list.GetResourceVersion()
+	if w.listed != nil {
+		w.listed <- struct{}{}
+		w.listed = nil
+	}
+	return nil
+}
+
+func (w *watcher) process(uid string, object map[string]interface{}, eventType string, listed bool) {
+	if eventType == string(watch.Deleted) {
+		delete(w.known, uid)
+	} else {
+		w.known[uid] = identity(object)
+	}
+	w.events <- nativeEvent{object: object, eventType: eventType, receivedAt: time.Now(), listed: listed}
+}
+
+// identity keeps what is needed to send the DELETED event of an object: its kind,
+// name, namespace and uid, and the labels and owners that filters go by
+func identity(object map[string]interface{}) map[string]interface{} {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	identityMetadata := map[string]interface{}{}
+	for _, key := range []string{"name", "namespace", "uid", "labels", "ownerReferences"} {
+		if value, ok := metadata[key]; ok {
+			identityMetadata[key] = value
+		}
+	}
+	return map[string]interface{}{
+		"apiVersion": object["apiVersion"],
+		"kind":       object["kind"],
+		"metadata":   identityMetadata,
+	}
+}
@@ -0,0 +1,98 @@
+package watchchanges
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// ownerFilter lets through a root object and everything it owns, directly or
+// through intermediate objects (e.g. Deployment -> ReplicaSet -> Pod). The
+// intermediate kinds need to be watched too for the chain to be known.
+type ownerFilter struct {
+	root string
+	// owners maps the uid of every object seen so far to the uids of its owners
+	owners map[string][]string
+	// pending holds the last event of objects not (yet) known to descend from the root
+	pending map[string]nativeEvent
+}
+
+func newOwnerFilter(ctx context.Context, mapper meta.RESTMapper, resourceClient func(*meta.RESTMapping) dynamic.ResourceInterface, owner string) (*ownerFilter, error) {
+	resource, name, found := strings.Cut(owner, "/")
+	if !found || resource == "" || name == "" {
+		return nil, fmt.Errorf("invalid owner %q, expected <resource>/<name>", owner)
+	}
+
+	mapping, err := resolveResource(mapper, resource)
+	if err != nil {
+		return nil, err
+	}
+	object, err := resourceClient(mapping).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner %q: %w", owner, err)
+	}
+
+	return &ownerFilter{
+		root:    string(object.GetUID()),
+		owners:  map[string][]string{},
+		pending: map[string]nativeEvent{},
+	}, nil
+}
+
+// filter records the owners of the object in the event and returns the events to
+// show: the event itself if the object descends from the root, along with earlier
+// events of objects which only now turn out to descend from the root because
+// their owner arrived after them.
+func (f *ownerFilter) filter(event nativeEvent) []nativeEvent {
+	u := &unstructured.Unstructured{Object: event.object}
+	uid := string(u.GetUID())
+
+	var owners []string
+	for _, ownerReference := range u.GetOwnerReferences() {
+		owners = append(owners, string(ownerReference.UID))
+	}
+	f.owners[uid] = owners
+
+	matched := f.descendsFromRoot(uid, map[string]bool{})
+	if event.eventType == string(watch.Deleted) {
+		delete(f.owners, uid)
+		delete(f.pending, uid)
+	} else if !matched {
+		f.pending[uid] = event
+	}
+	if !matched {
+		return nil
+	}
+
+	result := []nativeEvent{event}
+	for pendingUID, pendingEvent := range f.pending {
+		if f.descendsFromRoot(pendingUID, map[string]bool{}) {
+			delete(f.pending, pendingUID)
+			result = append(result, pendingEvent)
+		}
+	}
+	return result
+}
+
+func (f *ownerFilter) descendsFromRoot(uid string, visited map[string]bool) bool {
+	if uid == f.root {
+		return true
+	}
+	if visited[uid] {
+		return false
+	}
+	visited[uid] = true
+
+	for _, owner := range f.owners[uid] {
+		if f.descendsFromRoot(owner, visited) {
+			return true
+		}
+	}
+	return false
+}
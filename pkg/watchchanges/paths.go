@@ -0,0 +1,208 @@
+package watchchanges
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fieldPath is a parsed path pattern such as `status.conditions[*].lastHeartbeatTime`.
+//
+// Each segment matches a map key (with `*` and `?` wildcards) or, when written in
+// brackets, a list index (`[*]` or `[0]`). `**` matches any number of segments.
+// Keys containing dots can be escaped (`metadata.annotations.foo\.io/bar`) or
+// quoted (`metadata.annotations["foo.io/bar"]`). A leading `$` or `.` is ignored
+// so that simple JSONPath expressions work too.
+type fieldPath []pathSegment
+
+type pathSegment struct {
+	pattern string
+	index   bool
+}
+
+const anyDepth = "**"
+
+func parseFieldPath(path string) (fieldPath, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+
+	var segments fieldPath
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, pathSegment{pattern: current.String()})
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 < len(path) {
+				i++
+				current.WriteByte(path[i])
+			}
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: unterminated [", path)
+			}
+			inner := path[i+1 : i+end]
+			i += end
+
+			if unquoted, err := strconv.Unquote(inner); err == nil {
+				segments = append(segments, pathSegment{pattern: unquoted})
+			} else if len(inner) >= 2 && inner[0] == '\'' && inner[len(inner)-1] == '\'' {
+				segments = append(segments, pathSegment{pattern: inner[1 : len(inner)-1]})
+			} else {
+				segments = append(segments, pathSegment{pattern: inner, index: true})
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+
+	return segments, nil
+}
+
+// matchesKey reports whether the segment matches a key of a map
+func (s pathSegment) matchesKey(key string) bool {
+	return !s.index && globMatch(s.pattern, key)
+}
+
+// matchesIndex reports whether the segment matches an element of a list
+func (s pathSegment) matchesIndex(index int) bool {
+	if s.pattern == "*" || s.pattern == "" {
+		return true
+	}
+	return s.index && s.pattern == strconv.Itoa(index)
+}
+
+// remove deletes every field matching the path from value, and returns the
+// updated value (lists are copied, maps are modified in place).
+func (p fieldPath) remove(value interface{}) interface{} {
+	return p.update(value, func(interface{}) (interface{}, bool) { return nil, false })
+}
+
+// update replaces every field matching the path with the result of fn, or deletes
+// it if fn returns false, and returns the updated value (lists are copied, maps
+// are modified in place).
+func (p fieldPath) update(value interface{}, fn func(interface{}) (interface{}, bool)) interface{} {
+	if len(p) == 0 {
+		return value
+	}
+
+	segment, rest := p[0], p[1:]
+	if segment.pattern == anyDepth {
+		// ** matches zero segments, or one segment and keeps matching
+		value = rest.update(value, fn)
+		return updateChildren(value, pathSegment{pattern: "*"}, p, fn)
+	}
+	return updateChildren(value, segment, rest, fn)
+}
+
+// updateChildren applies rest to the children of value matched by segment, or
+// applies fn to those children if rest is empty.
+func updateChildren(value interface{}, segment pathSegment, rest fieldPath, fn func(interface{}) (interface{}, bool)) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if !segment.matchesKey(key) {
+				continue
+			}
+			if len(rest) > 0 {
+				typed[key] = rest.update(child, fn)
+			} else if updated, keep := fn(child); keep {
+				typed[key] = updated
+			} else {
+				delete(typed, key)
+			}
+		}
+		return typed
+	case []interface{}:
+		result := make([]interface{}, 0, len(typed))
+		for i, child := range typed {
+			if !segment.matchesIndex(i) {
+				result = append(result, child)
+				continue
+			}
+			if len(rest) > 0 {
+				result = append(result, rest.update(child, fn))
+			} else if updated, keep := fn(child); keep {
+				result = append(result, updated)
+			}
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// collect returns the values of every field matching the path, in a stable order
+func (p fieldPath) collect(value interface{}) []interface{} {
+	if len(p) == 0 {
+		return []interface{}{value}
+	}
+
+	segment, rest := p[0], p[1:]
+	var result []interface{}
+	if segment.pattern == anyDepth {
+		result = rest.collect(value)
+		segment, rest = pathSegment{pattern: "*"}, p
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			if segment.matchesKey(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			result = append(result, rest.collect(typed[key])...)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			if segment.matchesIndex(i) {
+				result = append(result, rest.collect(child)...)
+			}
+		}
+	}
+	return result
+}
+
+// globMatch matches s against a pattern where * matches any sequence of characters
+// (including dots and slashes) and ? matches any single character.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,151 @@
+package watchchanges
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    fieldPath
+		wantErr bool
+	}{
+		{
+			path: "metadata.annotations",
+			want: fieldPath{{pattern: "metadata"}, {pattern: "annotations"}},
+		},
+		{
+			path: "$.spec.containers[*].image",
+			want: fieldPath{{pattern: "spec"}, {pattern: "containers"}, {pattern: "*", index: true}, {pattern: "image"}},
+		},
+		{
+			path: "spec.containers[0]",
+			want: fieldPath{{pattern: "spec"}, {pattern: "containers"}, {pattern: "0", index: true}},
+		},
+		{
+			path: `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+			want: fieldPath{{pattern: "metadata"}, {pattern: "annotations"}, {pattern: "kubectl.kubernetes.io/last-applied-configuration"}},
+		},
+		{
+			path: `metadata.labels['app.kubernetes.io/name']`,
+			want: fieldPath{{pattern: "metadata"}, {pattern: "labels"}, {pattern: "app.kubernetes.io/name"}},
+		},
+		{
+			path: `data.config\.yaml`,
+			want: fieldPath{{pattern: "data"}, {pattern: "config.yaml"}},
+		},
+		{
+			path: "**.managedFields",
+			want: fieldPath{{pattern: anyDepth}, {pattern: "managedFields"}},
+		},
+		{path: "", wantErr: true},
+		{path: "$", wantErr: true},
+		{path: "spec.containers[0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseFieldPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFieldPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFieldPath() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldPathUpdate(t *testing.T) {
+	redact := func(interface{}) (interface{}, bool) { return "<redacted>", true }
+	remove := func(interface{}) (interface{}, bool) { return nil, false }
+
+	tests := []struct {
+		name   string
+		path   string
+		fn     func(interface{}) (interface{}, bool)
+		object string
+		want   string
+	}{
+		{
+			name:   "remove a field",
+			path:   "metadata.resourceVersion",
+			fn:     remove,
+			object: `{"metadata": {"name": "foo", "resourceVersion": "1"}}`,
+			want:   `{"metadata": {"name": "foo"}}`,
+		},
+		{
+			name:   "replace a quoted key",
+			path:   `metadata.annotations["example.com/token"]`,
+			fn:     redact,
+			object: `{"metadata": {"annotations": {"example.com/token": "secret", "other": "x"}}}`,
+			want:   `{"metadata": {"annotations": {"example.com/token": "<redacted>", "other": "x"}}}`,
+		},
+		{
+			name:   "every list element",
+			path:   "spec.containers[*].image",
+			fn:     redact,
+			object: `{"spec": {"containers": [{"name": "a", "image": "x"}, {"name": "b", "image": "y"}]}}`,
+			want:   `{"spec": {"containers": [{"name": "a", "image": "<redacted>"}, {"name": "b", "image": "<redacted>"}]}}`,
+		},
+		{
+			name:   "one list element",
+			path:   "spec.containers[1]",
+			fn:     remove,
+			object: `{"spec": {"containers": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}}`,
+			want:   `{"spec": {"containers": [{"name": "a"}, {"name": "c"}]}}`,
+		},
+		{
+			name:   "glob of keys",
+			path:   "data.*password*",
+			fn:     redact,
+			object: `{"data": {"db-password-1": "a", "user": "b"}}`,
+			want:   `{"data": {"db-password-1": "<redacted>", "user": "b"}}`,
+		},
+		{
+			name:   "any depth",
+			path:   "**.managedFields",
+			fn:     remove,
+			object: `{"metadata": {"managedFields": []}, "items": [{"metadata": {"managedFields": [], "name": "a"}}]}`,
+			want:   `{"metadata": {}, "items": [{"metadata": {"name": "a"}}]}`,
+		},
+		{
+			name:   "missing path",
+			path:   "spec.template.spec",
+			fn:     remove,
+			object: `{"spec": {"replicas": 1}}`,
+			want:   `{"spec": {"replicas": 1}}`,
+		},
+		{
+			name:   "path into a scalar",
+			path:   "spec.replicas.value",
+			fn:     remove,
+			object: `{"spec": {"replicas": 1}}`,
+			want:   `{"spec": {"replicas": 1}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parseFieldPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseFieldPath() error = %v", err)
+			}
+			got := path.update(mustUnmarshal(t, tt.object), tt.fn)
+			if want := mustUnmarshal(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("update() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func mustUnmarshal(t *testing.T, value string) interface{} {
+	t.Helper()
+	var result interface{}
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", value, err)
+	}
+	return result
+}
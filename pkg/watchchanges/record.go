@@ -0,0 +1,135 @@
+package watchchanges
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// receivedAtKey is added to the watch events written to a --record file
+const receivedAtKey = "receivedAt"
+
+// recorder is the --record file, nil when not recording
+var recorder *os.File
+
+func openRecorder() {
+	if options.Record == "" {
+		return
+	}
+
+	var err error
+	recorder, err = os.OpenFile(options.Record, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		panic(fmt.Errorf("failed to open record file %s: %w", options.Record, err))
+	}
+}
+
+// recordEvent appends a watch event to the --record file, along with the time it was
+// received. It has to be called before the event is processed, as processing
+// modifies the object. Secrets are redacted unless --show-secrets is set.
+func recordEvent(event map[string]interface{}, receivedAt time.Time) {
+	if recorder == nil {
+		return
+	}
+
+	event = redactEvent(event)
+	recorded := make(map[string]interface{}, len(event)+1)
+	for key, value := range event {
+		recorded[key] = value
+	}
+	recorded[receivedAtKey] = receivedAt.Format(time.RFC3339Nano)
+
+	if _, err := recorder.WriteString(mustMarshalCompactJson(recorded) + "\n"); err != nil {
+		panic(fmt.Errorf("failed to write record file %s: %w", options.Record, err))
+	}
+}
+
+// ReplayOptions configures Replay
+type ReplayOptions struct {
+	Options
+
+	File  string
+	Since time.Time
+	Until time.Time
+	// Speed is how much faster than real time events are replayed, 0 means no delay at all
+	Speed float64
+}
+
+// Replay runs the events of a --record file through the renderer again
+func Replay(opts ReplayOptions) {
+	setOptions(opts.Options)
+	startSummary(time.Time{})
+
+	file, err := os.Open(opts.File)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	// previous is the time of the last event shown, last of the last event read,
+	// to find the end of the initial list
+	var previous, last time.Time
+	listing = true
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 10*64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		event := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			fmt.Fprintf(os.Stderr, "Warn: skipping invalid line in %s: %v\n", opts.File, err)
+			continue
+		}
+
+		receivedAtValue, _ := event[receivedAtKey].(string)
+		receivedAt, err := time.Parse(time.RFC3339Nano, receivedAtValue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warn: skipping event without %s in %s\n", receivedAtKey, opts.File)
+			continue
+		}
+
+		// Objects before --since still go through processing, silently, so that the
+		// first changes after --since are diffed against the right state
+		beforeSince := !opts.Since.IsZero() && receivedAt.Before(opts.Since)
+		// The first gap between events marks the end of the initial list
+		if listing && !last.IsZero() && receivedAt.Sub(last) >= initialListGap {
+			quiet = beforeSince
+			reportMissing(last, seenInScope, showMissing)
+			quiet = false
+			listing = false
+		}
+		last = receivedAt
+
+		if beforeSince {
+			replayQuietly(event, receivedAt)
+			continue
+		}
+		if !opts.Until.IsZero() && receivedAt.After(opts.Until) {
+			break
+		}
+
+		if opts.Speed > 0 && !previous.IsZero() && receivedAt.After(previous) {
+			time.Sleep(time.Duration(float64(receivedAt.Sub(previous)) / opts.Speed))
+		}
+		previous = receivedAt
+
+		processEvent(event, receivedAt)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading %s: %v\n", opts.File, err)
+		os.Exit(1)
+	}
+	reportMissing(last, seenInScope, showMissing)
+	listing = false
+	finishSummary(previous)
+	waitHooks()
+	waitTUI()
+}
+
+// replayQuietly updates the state with an event without printing anything
+func replayQuietly(event map[string]interface{}, receivedAt time.Time) {
+	quiet = true
+	defer func() { quiet = false }()
+	processEvent(event, receivedAt)
+}
@@ -0,0 +1,179 @@
+package watchchanges
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/KevinWang15/k/pkg/model"
+	"github.com/KevinWang15/k/pkg/utils"
+)
+
+// defaultRedactRules keep the values of Secrets out of the output, even when the
+// configuration has not been loaded (e.g. for RenderObjectDiff)
+var defaultRedactRules = mustParsePathRules([]model.PathRule{
+	{Kind: "Secret", Paths: []string{"data", "stringData", `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`}},
+})
+
+// redactRules are loaded when watch-changes starts, see loadRedactRules
+var redactRules = defaultRedactRules
+
+// loadRedactRules adds the redact rules from config.json and from K_REDACT_PATHS,
+// in the same format as K_IGNORE_PATHS, to the default ones
+func loadRedactRules() {
+	var rules []model.PathRule
+	if config := utils.GetConfig().WatchChanges; config != nil {
+		rules = append(rules, config.RedactPaths...)
+	}
+	rules = append(rules, parsePathRulesEnv(os.Getenv(consts.K_REDACT_PATHS))...)
+
+	parsed, err := parsePathRules(rules)
+	if err != nil {
+		panic(fmt.Errorf("failed to parse redact paths: %w", err))
+	}
+	redactRules = append(append([]pathRule{}, defaultRedactRules...), parsed...)
+}
+
+func mustParsePathRules(rules []model.PathRule) []pathRule {
+	parsed, err := parsePathRules(rules)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// protectSecrets redacts the sensitive fields of an object, unless --show-secrets
+// is set, in which case the data of Secrets is base64 decoded if --decode-secrets is set
+func protectSecrets(kind string, object map[string]interface{}) {
+	if options.DecodeSecrets {
+		if strings.EqualFold(kind, "Secret") {
+			if data, ok := object["data"].(map[string]interface{}); ok {
+				for key, value := range data {
+					data[key] = decodeSecretValue(value)
+				}
+			}
+		}
+		return
+	}
+	if options.ShowSecrets {
+		return
+	}
+
+	for _, rule := range redactRules {
+		if !rule.appliesTo(kind) {
+			continue
+		}
+		for _, path := range rule.paths {
+			path.update(object, func(value interface{}) (interface{}, bool) {
+				return redact(value), true
+			})
+		}
+	}
+}
+
+// redact replaces a value by a hash of it, so that changes can still be told
+// apart. The keys of maps and the length of lists are kept.
+func redact(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			typed[key] = redact(child)
+		}
+		return typed
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, child := range typed {
+			result[i] = redact(child)
+		}
+		return result
+	case nil:
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	mac := hmac.New(sha256.New, redactKey())
+	mac.Write(data)
+	return "<redacted hmac:" + hex.EncodeToString(mac.Sum(nil))[:12] + ">"
+}
+
+var (
+	redactKeyOnce  sync.Once
+	redactKeyBytes []byte
+)
+
+// redactKey is the key values are hashed with, so that short values can't be
+// found by brute force from their hash. It is kept in ~/.k/redact.key so that
+// hashes stay comparable across runs, recordings and stored revisions.
+func redactKey() []byte {
+	redactKeyOnce.Do(func() {
+		key, err := os.ReadFile(consts.K_REDACT_KEY_PATH)
+		if err == nil && len(key) >= 32 {
+			redactKeyBytes = key
+			return
+		}
+
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Errorf("failed to generate redact key: %w", err))
+		}
+		redactKeyBytes = key
+		utils.EnsureKHomeDir()
+		if err := os.WriteFile(consts.K_REDACT_KEY_PATH, key, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "Warn: failed to save redact key, hashes of redacted values will differ between runs: %v\n", err)
+		}
+	})
+	return redactKeyBytes
+}
+
+// decodeSecretValue decodes a value of the data of a Secret, values that are not
+// readable text are kept as they are
+func decodeSecretValue(value interface{}) interface{} {
+	encoded, ok := value.(string)
+	if !ok {
+		return value
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !utf8.Valid(decoded) {
+		return value
+	}
+	return string(decoded)
+}
+
+// redactEvent returns a copy of a watch event with the sensitive fields redacted,
+// to be written to a --record file
+func redactEvent(event map[string]interface{}) map[string]interface{} {
+	if options.ShowSecrets || options.DecodeSecrets {
+		return event
+	}
+
+	var copied map[string]interface{}
+	if err := json.Unmarshal([]byte(mustMarshalCompactJson(event)), &copied); err != nil {
+		panic(err)
+	}
+
+	object, _ := copied["object"].(map[string]interface{})
+	kind, _ := object["kind"].(string)
+	if items, ok := object["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+		for _, item := range items {
+			if itemObject, ok := item.(map[string]interface{}); ok {
+				itemKind, _ := itemObject["kind"].(string)
+				protectSecrets(itemKind, itemObject)
+			}
+		}
+	} else if object != nil {
+		protectSecrets(kind, object)
+	}
+	return copied
+}
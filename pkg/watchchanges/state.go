@@ -0,0 +1,90 @@
+package watchchanges
+
+import (
+	"container/list"
+	"time"
+)
+
+// trackedObject is the last seen state of an object, as marshaled JSON
+type trackedObject struct {
+	uid      string
+	value    string
+	lastSeen time.Time
+}
+
+// tracker holds the last seen state of every object, to diff the next version
+// against. Objects are dropped when they are deleted and, to bound the memory
+// of long running watches, when there are more than maxTracked of them (least
+// recently seen first) or when they have not been seen for ttl. Zero means no limit.
+type tracker struct {
+	maxTracked int
+	ttl        time.Duration
+
+	// order has the least recently seen object at the back
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newTracker(maxTracked int, ttl time.Duration) *tracker {
+	return &tracker{
+		maxTracked: maxTracked,
+		ttl:        ttl,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// get returns the last seen state of an object
+func (t *tracker) get(uid string, now time.Time) (string, bool) {
+	t.expire(now)
+	element, ok := t.entries[uid]
+	if !ok {
+		return "", false
+	}
+	return element.Value.(*trackedObject).value, true
+}
+
+// set stores the state of an object, marking it as the most recently seen
+func (t *tracker) set(uid string, value string, now time.Time) {
+	if element, ok := t.entries[uid]; ok {
+		object := element.Value.(*trackedObject)
+		object.value, object.lastSeen = value, now
+		t.order.MoveToFront(element)
+	} else {
+		t.entries[uid] = t.order.PushFront(&trackedObject{uid: uid, value: value, lastSeen: now})
+	}
+
+	for t.maxTracked > 0 && t.order.Len() > t.maxTracked {
+		t.removeElement(t.order.Back())
+	}
+	t.expire(now)
+}
+
+// remove forgets an object, returning its last seen state
+func (t *tracker) remove(uid string) (string, bool) {
+	element, ok := t.entries[uid]
+	if !ok {
+		return "", false
+	}
+	t.removeElement(element)
+	return element.Value.(*trackedObject).value, true
+}
+
+// expire drops the objects that have not been seen for ttl. Timestamps come from
+// the events, so that replayed sessions expire objects the same way.
+func (t *tracker) expire(now time.Time) {
+	if t.ttl <= 0 {
+		return
+	}
+	for element := t.order.Back(); element != nil; element = t.order.Back() {
+		if now.Sub(element.Value.(*trackedObject).lastSeen) <= t.ttl {
+			return
+		}
+		t.removeElement(element)
+	}
+}
+
+func (t *tracker) removeElement(element *list.Element) {
+	t.order.Remove(element)
+	delete(t.entries, element.Value.(*trackedObject).uid)
+}
@@ -0,0 +1,43 @@
+package watchchanges
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KevinWang15/k/pkg/revisions"
+)
+
+// storeFailed is set after the first failure to store a revision, to warn only once
+var storeFailed bool
+
+// storeRevision keeps a change in the on-disk revision store, if --store-revisions
+// is set. It is called for every change, whether it is shown or not.
+func storeRevision(c change) {
+	if !options.StoreRevisions || storeFailed {
+		return
+	}
+	if c.eventType != "ADDED" && c.eventType != "MODIFIED" && c.eventType != "DELETED" {
+		return
+	}
+
+	var object bytes.Buffer
+	if err := json.Compact(&object, []byte(c.newValue)); err != nil {
+		panic(fmt.Errorf("failed to compact object: %w", err))
+	}
+
+	group, _, found := strings.Cut(c.apiVersion, "/")
+	if !found {
+		group = ""
+	}
+	err := revisions.Append(
+		revisions.Object{Cluster: options.Cluster, Kind: c.kind, Group: group, Namespace: c.namespace, Name: c.name},
+		revisions.Revision{Timestamp: c.time, EventType: c.eventType, UID: c.uid, Object: object.Bytes()},
+	)
+	if err != nil {
+		storeFailed = true
+		fmt.Fprintf(os.Stderr, "Error: failed to store revisions, they will not be stored anymore: %v\n", err)
+	}
+}
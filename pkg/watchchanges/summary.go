@@ -0,0 +1,226 @@
+package watchchanges
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KevinWang15/k/pkg/colors"
+)
+
+// summaryTopN is the number of objects and field paths listed in a summary
+const summaryTopN = 10
+
+// objectStats counts the events of one object
+type objectStats struct {
+	kind      string
+	namespace string
+	name      string
+	added     int
+	modified  int
+	deleted   int
+}
+
+func (s *objectStats) total() int {
+	return s.added + s.modified + s.deleted
+}
+
+// summary aggregates the changes of a window, for `-o summary`
+type summary struct {
+	mu      sync.Mutex
+	start   time.Time
+	objects map[string]*objectStats
+	// paths counts the changes of every field path, keyed by kind and path
+	paths map[[2]string]int
+}
+
+var currentSummary *summary
+
+func newSummary(start time.Time) *summary {
+	return &summary{
+		start:   start,
+		objects: map[string]*objectStats{},
+		paths:   map[[2]string]int{},
+	}
+}
+
+// startSummary starts aggregating the changes if the output is OutputSummary. The
+// summary is printed every SummaryInterval, if set, and when watch-changes is
+// interrupted. A zero start makes the window start at the first change.
+func startSummary(start time.Time) {
+	if options.Output != OutputSummary {
+		return
+	}
+	currentSummary = newSummary(start)
+
+	if options.SummaryInterval > 0 {
+		go func() {
+			for range time.Tick(options.SummaryInterval) {
+				printSummary(time.Now(), true)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		printSummary(time.Now(), false)
+		os.Exit(0)
+	}()
+}
+
+// finishSummary prints the summary of the last window, when the events have run out
+func finishSummary(end time.Time) {
+	if currentSummary != nil {
+		printSummary(end, false)
+	}
+}
+
+// printSummary prints the report of the current window, and starts a new one if reset is set
+func printSummary(end time.Time, reset bool) {
+	s := currentSummary
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.print(end)
+	if reset {
+		s.start, s.objects, s.paths = end, map[string]*objectStats{}, map[[2]string]int{}
+	}
+}
+
+func (s *summary) add(c change) {
+	// ERROR events aren't about an object
+	switch c.eventType {
+	case "ADDED", "MODIFIED", "DELETED":
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.start.IsZero() {
+		s.start = c.time
+	}
+	stats, ok := s.objects[c.uid]
+	if !ok {
+		stats = &objectStats{kind: c.kind, namespace: c.namespace, name: c.name}
+		s.objects[c.uid] = stats
+	}
+
+	switch c.eventType {
+	case "ADDED":
+		stats.added++
+	case "MODIFIED":
+		stats.modified++
+		for _, fc := range diffFields(unmarshalValue(c.oldValue), unmarshalValue(c.newValue)) {
+			s.paths[[2]string{c.kind, formatPath(fc.path)}]++
+		}
+	case "DELETED":
+		stats.deleted++
+	}
+}
+
+func (s *summary) print(end time.Time) {
+	if s.start.IsZero() {
+		s.start = end
+	}
+	fmt.Printf("%s %s - %s (%s)\n", colors.Bold.Sprint("Summary"), s.start.Format(time.StampMilli), end.Format(time.StampMilli), end.Sub(s.start).Round(time.Second))
+	if len(s.objects) == 0 {
+		fmt.Printf("No changes\n\n")
+		return
+	}
+
+	// Per kind and namespace
+	type group struct {
+		kind, namespace                   string
+		objects, added, modified, deleted int
+	}
+	groups := map[[2]string]*group{}
+	var objects []*objectStats
+	for _, stats := range s.objects {
+		key := [2]string{stats.kind, stats.namespace}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{kind: stats.kind, namespace: stats.namespace}
+			groups[key] = g
+		}
+		g.objects++
+		g.added += stats.added
+		g.modified += stats.modified
+		g.deleted += stats.deleted
+		objects = append(objects, stats)
+	}
+	sortedGroups := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sortedGroups = append(sortedGroups, g)
+	}
+	sort.Slice(sortedGroups, func(i, j int) bool {
+		if sortedGroups[i].kind != sortedGroups[j].kind {
+			return sortedGroups[i].kind < sortedGroups[j].kind
+		}
+		return sortedGroups[i].namespace < sortedGroups[j].namespace
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tOBJECTS\tADDED\tMODIFIED\tDELETED")
+	for _, g := range sortedGroups {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", g.kind, namespaceOrPlaceholder(g.namespace), g.objects, g.added, g.modified, g.deleted)
+	}
+	w.Flush()
+
+	// The objects that changed the most, i.e. the ones flapping
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].modified != objects[j].modified {
+			return objects[i].modified > objects[j].modified
+		}
+		if objects[i].total() != objects[j].total() {
+			return objects[i].total() > objects[j].total()
+		}
+		return objects[i].kind+"/"+objects[i].namespace+"/"+objects[i].name < objects[j].kind+"/"+objects[j].namespace+"/"+objects[j].name
+	})
+	if len(objects) > summaryTopN {
+		objects = objects[:summaryTopN]
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tOBJECT\tADDED\tMODIFIED\tDELETED")
+	for _, stats := range objects {
+		fmt.Fprintf(w, "%s\t%s/%s\t%d\t%d\t%d\n", stats.kind, namespaceOrPlaceholder(stats.namespace), stats.name, stats.added, stats.modified, stats.deleted)
+	}
+	w.Flush()
+
+	// The field paths that changed the most
+	if len(s.paths) > 0 {
+		paths := make([][2]string, 0, len(s.paths))
+		for path := range s.paths {
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			if s.paths[paths[i]] != s.paths[paths[j]] {
+				return s.paths[paths[i]] > s.paths[paths[j]]
+			}
+			if paths[i][0] != paths[j][0] {
+				return paths[i][0] < paths[j][0]
+			}
+			return paths[i][1] < paths[j][1]
+		})
+		if len(paths) > summaryTopN {
+			paths = paths[:summaryTopN]
+		}
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tFIELD\tCHANGES")
+		for _, path := range paths {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", path[0], path[1], s.paths[path])
+		}
+		w.Flush()
+	}
+	fmt.Println()
+}
@@ -0,0 +1,506 @@
+package watchchanges
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KevinWang15/k/pkg/colors"
+	"golang.org/x/term"
+)
+
+// tuiMaxRevisions is the number of revisions retained per object in the TUI
+const tuiMaxRevisions = 100
+
+// tuiRevision is one state of an object, as marshaled JSON
+type tuiRevision struct {
+	time      time.Time
+	eventType string
+	value     string
+}
+
+type tuiObject struct {
+	kind      string
+	namespace string
+	name      string
+	// changes counts every change, including the ones whose revision is no longer retained
+	changes   int
+	deleted   bool
+	revisions []tuiRevision
+}
+
+func (o *tuiObject) title() string {
+	return o.kind + " " + namespaceOrPlaceholder(o.namespace) + "/" + o.name
+}
+
+// Parts of the TUI that have the focus
+const (
+	focusObjects = iota
+	focusTimeline
+)
+
+// tui is `-o tui`: the object list on the left, and the timeline and a diff of
+// the selected object on the right. Changes come from emit, keys from the terminal.
+type tui struct {
+	mu    sync.Mutex
+	tty   *os.File
+	state *term.State
+
+	objects []*tuiObject
+	byUID   map[string]*tuiObject
+	changes int
+	status  string
+
+	focus    int
+	selected int
+	// revision is the selected revision of the selected object
+	revision int
+	// base is the revision the selected one is diffed against, -1 for the previous one
+	base       int
+	diffScroll int
+	fieldDiff  bool
+
+	redraw chan struct{}
+}
+
+var currentTUI *tui
+
+// startTUI takes over the terminal if the output is OutputTUI. Keys are read from
+// /dev/tty, as stdin may be the stream of events.
+func startTUI() {
+	if options.Output != OutputTUI {
+		return
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -o tui needs a terminal: %v\n", err)
+		os.Exit(1)
+	}
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -o tui needs a terminal: %v\n", err)
+		os.Exit(1)
+	}
+
+	t := &tui{
+		tty:       tty,
+		state:     state,
+		byUID:     map[string]*tuiObject{},
+		base:      -1,
+		fieldDiff: options.DiffMode == DiffModeField,
+		redraw:    make(chan struct{}, 1),
+	}
+	currentTUI = t
+	// The TUI is drawn on the terminal, whatever stdout is
+	colors.ForTerminal()
+
+	// Enter the alternate screen and hide the cursor
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l")
+	t.captureStderr()
+
+	go t.readKeys()
+	go t.drawLoop()
+	t.requestRedraw()
+}
+
+// waitTUI keeps the TUI open after the events have run out, until it is quit
+func waitTUI() {
+	if currentTUI == nil {
+		return
+	}
+	currentTUI.mu.Lock()
+	currentTUI.status = "No more events, q to quit"
+	currentTUI.mu.Unlock()
+	currentTUI.requestRedraw()
+	select {}
+}
+
+// captureStderr shows the warnings in the status line rather than over the TUI
+func (t *tui) captureStderr() {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	os.Stderr = writer
+
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			t.mu.Lock()
+			t.status = scanner.Text()
+			t.mu.Unlock()
+			t.requestRedraw()
+		}
+	}()
+}
+
+func (t *tui) quit() {
+	fmt.Fprint(t.tty, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(t.tty.Fd()), t.state)
+	os.Exit(0)
+}
+
+func (t *tui) requestRedraw() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// add records a change as a new revision of its object
+func (t *tui) add(c change) {
+	if c.eventType == "ERROR" {
+		t.mu.Lock()
+		t.status = "ERROR: " + c.message
+		t.mu.Unlock()
+		t.requestRedraw()
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	object, ok := t.byUID[c.uid]
+	if !ok {
+		object = &tuiObject{kind: c.kind, namespace: c.namespace, name: c.name}
+		t.byUID[c.uid] = object
+		t.objects = append(t.objects, object)
+	}
+
+	isSelected := t.selected < len(t.objects) && t.objects[t.selected] == object
+	following := isSelected && t.revision == len(object.revisions)-1
+
+	object.changes++
+	object.deleted = c.eventType == "DELETED"
+	object.revisions = append(object.revisions, tuiRevision{time: c.time, eventType: c.eventType, value: c.newValue})
+	if len(object.revisions) > tuiMaxRevisions {
+		object.revisions = object.revisions[1:]
+		if isSelected {
+			t.revision--
+			if t.base >= 0 {
+				t.base--
+			}
+		}
+	}
+	t.changes++
+
+	if following {
+		t.revision = len(object.revisions) - 1
+		t.diffScroll = 0
+	}
+	if len(t.objects) == 1 {
+		t.revision = len(object.revisions) - 1
+	}
+
+	t.requestRedraw()
+}
+
+func (t *tui) drawLoop() {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGTERM, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-t.redraw:
+		case <-resized:
+		case <-terminated:
+			t.quit()
+		}
+		t.draw()
+	}
+}
+
+func (t *tui) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := t.tty.Read(buf)
+		if err != nil {
+			t.quit()
+		}
+
+		t.mu.Lock()
+		quit := t.handleKey(string(buf[:n]))
+		t.mu.Unlock()
+		if quit {
+			t.quit()
+		}
+		t.requestRedraw()
+	}
+}
+
+// handleKey updates the state for a key press, it returns true to quit
+func (t *tui) handleKey(key string) bool {
+	_, height, _ := term.GetSize(int(t.tty.Fd()))
+	page := height / 2
+	if page < 1 {
+		page = 1
+	}
+
+	switch key {
+	case "q", "\x03":
+		return true
+	case "\t":
+		t.focus = (t.focus + 1) % 2
+	case "\x1b[A", "k":
+		t.move(-1)
+	case "\x1b[B", "j":
+		t.move(1)
+	case "g":
+		t.move(-len(t.objects) - tuiMaxRevisions)
+	case "G":
+		t.move(len(t.objects) + tuiMaxRevisions)
+	case " ":
+		// Marks the selected revision as the base of the diff, or unmarks it
+		if t.base == t.revision {
+			t.base = -1
+		} else {
+			t.base = t.revision
+		}
+		t.diffScroll = 0
+	case "f":
+		t.fieldDiff = !t.fieldDiff
+		t.diffScroll = 0
+	case "\x1b[5~", "u":
+		t.diffScroll -= page
+		if t.diffScroll < 0 {
+			t.diffScroll = 0
+		}
+	case "\x1b[6~", "d":
+		t.diffScroll += page
+	}
+	return false
+}
+
+// move moves the selection of the focused part by delta
+func (t *tui) move(delta int) {
+	if len(t.objects) == 0 {
+		return
+	}
+
+	if t.focus == focusObjects {
+		t.selected = clamp(t.selected+delta, 0, len(t.objects)-1)
+		t.revision = len(t.objects[t.selected].revisions) - 1
+		t.base = -1
+	} else {
+		t.revision = clamp(t.revision+delta, 0, len(t.objects[t.selected].revisions)-1)
+	}
+	t.diffScroll = 0
+}
+
+func clamp(value, low, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+func (t *tui) draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	width, height, err := term.GetSize(int(t.tty.Fd()))
+	if err != nil || width < 20 || height < 5 {
+		return
+	}
+
+	leftWidth := width / 3
+	if leftWidth > 50 {
+		leftWidth = 50
+	}
+	rightWidth := width - leftWidth - 1
+	bodyHeight := height - 2
+
+	left := t.objectLines(leftWidth, bodyHeight)
+	right := t.detailLines(rightWidth, bodyHeight)
+
+	var frame strings.Builder
+	frame.WriteString("\x1b[H")
+	header := fmt.Sprintf(" k watch-changes  %d objects, %d changes", len(t.objects), t.changes)
+	frame.WriteString("\x1b[7m" + fitWidth(header, width) + "\x1b[0m\r\n")
+	for i := 0; i < bodyHeight; i++ {
+		frame.WriteString(fitWidth(lineAt(left, i), leftWidth))
+		frame.WriteString(colors.Faint.Sprint("│"))
+		frame.WriteString(fitWidth(lineAt(right, i), rightWidth))
+		frame.WriteString("\r\n")
+	}
+	footer := " ↑↓/jk move  tab switch  space set base  f field/unified  u/d scroll  q quit"
+	if t.status != "" {
+		footer = " " + t.status
+	}
+	frame.WriteString("\x1b[7m" + fitWidth(footer, width) + "\x1b[0m")
+
+	t.tty.WriteString(frame.String())
+}
+
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// objectLines renders the object list, scrolled so that the selection is visible
+func (t *tui) objectLines(width, height int) []string {
+	start := 0
+	if t.selected >= height {
+		start = t.selected - height + 1
+	}
+
+	var lines []string
+	for i := start; i < len(t.objects) && len(lines) < height; i++ {
+		object := t.objects[i]
+		count := fmt.Sprintf(" %d", object.changes)
+		title := fitWidth(" "+kindColor(object.kind).Sprint(object.kind)+" "+namespaceOrPlaceholder(object.namespace)+"/"+object.name, width-len(count))
+		if object.deleted {
+			title = fitWidth(" "+colors.Faint.Sprint(object.title()+" (deleted)"), width-len(count))
+		}
+		line := title + count
+		if i == t.selected {
+			if t.focus == focusObjects {
+				line = "\x1b[7m" + fitWidth(" "+object.title(), width-len(count)) + count + "\x1b[0m"
+			} else {
+				line = colors.Bold.Sprint(fitWidth(" "+object.title(), width-len(count)) + count)
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, colors.Faint.Sprint(" Waiting for changes..."))
+	}
+	return lines
+}
+
+// detailLines renders the timeline of the selected object and the diff of the selected revision
+func (t *tui) detailLines(width, height int) []string {
+	if t.selected >= len(t.objects) {
+		return nil
+	}
+	object := t.objects[t.selected]
+	revisions := object.revisions
+	if len(revisions) == 0 {
+		return nil
+	}
+	t.revision = clamp(t.revision, 0, len(revisions)-1)
+
+	// The timeline takes up to a third of the height
+	timelineHeight := height / 3
+	if timelineHeight > len(revisions) {
+		timelineHeight = len(revisions)
+	}
+	start := 0
+	if t.revision >= timelineHeight {
+		start = t.revision - timelineHeight + 1
+	}
+
+	lines := []string{colors.Bold.Sprint(" " + object.title())}
+	for i := start; i < start+timelineHeight; i++ {
+		revision := revisions[i]
+		marker := "  "
+		if i == t.base {
+			marker = "* "
+		}
+		line := fmt.Sprintf(" %s#%-3d %s  %s", marker, object.changes-len(revisions)+i+1, revision.time.Format(time.StampMilli), eventTypeColor(revision.eventType).Sprint(revision.eventType))
+		if i == t.revision {
+			if t.focus == focusTimeline {
+				line = "\x1b[7m" + fitWidth(line, width) + "\x1b[0m"
+			} else {
+				line = colors.Bold.Sprint(line)
+			}
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, colors.Faint.Sprint(strings.Repeat("─", width)))
+
+	diffLines := strings.Split(strings.TrimRight(t.diffText(object.kind, revisions), "\n"), "\n")
+	t.diffScroll = clamp(t.diffScroll, 0, len(diffLines)-1)
+	return append(lines, diffLines[t.diffScroll:]...)
+}
+
+// diffText renders the selected revision against the base, or the previous revision
+func (t *tui) diffText(kind string, revisions []tuiRevision) string {
+	base := t.base
+	if base < 0 || base >= len(revisions) || base == t.revision {
+		base = t.revision - 1
+	}
+
+	newValue := revisions[t.revision].value
+	if base < 0 {
+		return renderDiff("", formatBody(newValue))
+	}
+	oldValue := revisions[base].value
+	if oldValue == newValue {
+		return colors.Faint.Sprint("No changes")
+	}
+	var result string
+	if options.Headlines != HeadlinesOff {
+		result = renderHeadlines(headlines(kind, oldValue, newValue))
+	}
+	oldValue, newValue = expandForDiff(oldValue), expandForDiff(newValue)
+	if t.fieldDiff {
+		return result + renderFieldDiff(oldValue, newValue)
+	}
+	return result + renderDiff(formatBody(oldValue), formatBody(newValue))
+}
+
+func eventTypeColor(eventType string) interface{ Sprint(...interface{}) string } {
+	switch eventType {
+	case "ADDED", "SYNCED":
+		return colors.AddedLabel
+	case "MODIFIED", "DRIFTED":
+		return colors.ModifiedLabel
+	default:
+		return colors.RemovedLabel
+	}
+}
+
+// fitWidth cuts or pads a string with ANSI escape sequences to a visible width
+func fitWidth(s string, width int) string {
+	var result strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			end := i + 1
+			if end < len(s) && s[end] == '[' {
+				end++
+				for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+					end++
+				}
+				end++
+			}
+			if end > len(s) {
+				end = len(s)
+			}
+			result.WriteString(s[i:end])
+			i = end
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if visible >= width {
+			continue
+		}
+		if r == '\t' {
+			r = ' '
+		}
+		result.WriteRune(r)
+		visible++
+	}
+	if visible < width {
+		result.WriteString(strings.Repeat(" ", width-visible))
+	}
+	result.WriteString("\x1b[0m")
+	return result.String()
+}
@@ -2,6 +2,7 @@ package watchchanges
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -9,14 +10,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/KevinWang15/k/pkg/colors"
 	"github.com/KevinWang15/k/pkg/consts"
 	"github.com/fatih/color"
 	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
 )
 
 var (
-	// Store old values keyed by uid
-	oldValues = make(map[string]string)
+	// tracked holds the last seen state of the objects, keyed by uid
+	tracked = newTracker(0, 0)
 
 	printBodyOfAdded = os.Getenv(consts.K_PRINT_BODY_OF_ADDED) == "true"
 
@@ -34,120 +37,517 @@ var (
 	})()
 )
 
-func Run() {
+// Output formats of watch-changes
+const (
+	OutputText  = "text"
+	OutputJSONL = "jsonl"
+	// OutputSummary only prints statistics of the changes, periodically or on exit
+	OutputSummary = "summary"
+	// OutputTUI browses the objects and their revisions interactively
+	OutputTUI = "tui"
+)
+
+// Diff modes of the text output
+const (
+	DiffModeUnified = "unified"
+	DiffModeField   = "field"
+)
+
+// Formats of the objects in the text output
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Options configures the output of watch-changes, whatever the events come from
+type Options struct {
+	// Output is OutputText or OutputJSONL
+	Output string
+	// IncludeObjects adds the full old and new objects to OutputJSONL records
+	IncludeObjects bool
+	// DiffMode is DiffModeUnified (a line diff of the objects) or DiffModeField
+	// (one line per changed field)
+	DiffMode string
+	// Format is FormatJSON or FormatYAML, for the unified diffs and the bodies of added objects
+	Format string
+	// Record is a file the raw events are appended to, to be replayed later
+	Record string
+	// Filter selects the objects to show
+	Filter Filter
+	// OnDelete is what is shown for deleted objects, OnDeleteName, OnDeleteBody or OnDeleteDiff
+	OnDelete string
+	// MaxTracked caps the number of objects whose state is kept, 0 means no limit
+	MaxTracked int
+	// TrackedTTL forgets the state of objects not seen for that long, 0 means never
+	TrackedTTL time.Duration
+	// ShowSecrets turns off the redaction of Secrets and of the configured redact paths
+	ShowSecrets bool
+	// DecodeSecrets shows the data of Secrets base64 decoded, it implies ShowSecrets
+	DecodeSecrets bool
+	// SummaryInterval is how often OutputSummary is printed, 0 means only on exit
+	SummaryInterval time.Duration
+	// Hooks runs the hooks of config.json on matching changes
+	Hooks bool
+	// ExpandEmbedded diffs the JSON and YAML documents embedded in ConfigMaps and
+	// annotations field by field
+	ExpandEmbedded bool
+	// StoreRevisions keeps every change in the revision store, under Cluster
+	StoreRevisions bool
+	// Cluster the events come from
+	Cluster string
+	// Baseline is a directory of manifests. When set, objects are compared with
+	// their manifest instead of their previous state, see checkDrift.
+	Baseline string
+	// Headlines is HeadlinesAbove, HeadlinesOnly or HeadlinesOff, for the one-line
+	// summaries of condition transitions, rollouts, restarts and image changes
+	Headlines string
+}
+
+// What is shown for deleted objects
+const (
+	OnDeleteName = "name"
+	OnDeleteBody = "body"
+	OnDeleteDiff = "diff"
+)
+
+// options are set by Run, RunNative and Replay
+var options Options
+
+func setOptions(opts Options) {
+	options = opts
+	if err := options.Filter.Compile(); err != nil {
+		panic(err)
+	}
+	if options.StoreRevisions && options.Cluster == "" {
+		fmt.Fprintf(os.Stderr, "Error: --store-revisions needs the cluster the events come from, pass --cluster\n")
+		os.Exit(1)
+	}
+	tracked = newTracker(options.MaxTracked, options.TrackedTTL)
+	loadIgnoreRules()
+	loadRedactRules()
+	loadBaseline()
+	startHooks()
+	startTUI()
+}
+
+// Run reads the output of `kubectl get -ojson --output-watch-events --watch` from stdin
+func Run(opts Options) {
+	setOptions(opts)
+	startSummary(time.Now())
 
 	scanner := bufio.NewScanner(os.Stdin)
 	buf := make([]byte, 0, 10*64*1024)
 	scanner.Buffer(buf, 10*1024*1024)
-	for scanner.Scan() {
-		line := scanner.Text()
-		processLine(line)
+	openRecorder()
+
+	lines := make(chan string)
+	go func() {
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	// kubectl doesn't mark the end of the initial list, it is taken to be complete
+	// when no line arrives for initialListGap
+	listing = true
+	listed := time.NewTimer(initialListGap)
+	defer listed.Stop()
+	for done := false; !done; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				done = true
+				break
+			}
+			processLine(line, time.Now())
+			if listing {
+				listed.Reset(initialListGap)
+			}
+		case <-listed.C:
+			reportMissing(time.Now(), seenInScope, showMissing)
+			listing = false
+		}
 	}
+	reportMissing(time.Now(), seenInScope, showMissing)
+	listing = false
 
 	if err := scanner.Err(); err != nil {
 		fmt.Fprintln(os.Stderr, "reading standard input:", err)
 	}
+	finishSummary(time.Now())
+	waitHooks()
+	waitTUI()
 }
 
-var (
-	faintWhite = color.New(color.FgWhite).Add(color.Faint)
-	boldGreen  = color.New(color.FgGreen).Add(color.Bold)
-	boldYellow = color.New(color.FgYellow).Add(color.Bold)
-	boldRed    = color.New(color.FgRed).Add(color.Bold)
-)
+// kindColors maps kinds to colors of the theme, handed out in the order kinds are
+// first seen, so that kinds can be told apart when several of them are watched at once
+var kindColors = map[string]*color.Color{}
+
+func kindColor(kind string) *color.Color {
+	if c, ok := kindColors[kind]; ok {
+		return c
+	}
+	c := colors.Kinds[len(kindColors)%len(colors.Kinds)]
+	kindColors[kind] = c
+	return c
+}
+
+// processLine processes a line of `kubectl get --output-watch-events` output. Lines
+// that are not watch events, e.g. warnings mixed into the stream, are reported and
+// skipped so that the watch keeps going.
+func processLine(line string, receivedAt time.Time) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
 
-func processLine(line string) {
 	parsedLine := map[string]interface{}{}
 	err := json.Unmarshal([]byte(line), &parsedLine)
 	if err != nil {
-		panic(fmt.Errorf("failed to unmarshal line: %w", err))
+		fmt.Fprintf(os.Stderr, "Warn: skipping line that is not a watch event: %s\n", truncate(line, 200))
+		return
+	}
+
+	recordEvent(parsedLine, receivedAt)
+	processEvent(parsedLine, receivedAt)
+}
+
+// processEvent processes a watch event, {"type": ..., "object": ...}
+func processEvent(event map[string]interface{}, receivedAt time.Time) {
+	eventType, _ := event["type"].(string)
+	object, ok := event["object"].(map[string]interface{})
+	if eventType == "" || !ok {
+		fmt.Fprintf(os.Stderr, "Warn: skipping watch event without a type or an object: %s\n", truncate(mustMarshalCompactJson(event), 200))
+		return
 	}
 
-	eventType := parsedLine["type"].(string)
-	object := parsedLine["object"].(map[string]interface{})
+	switch eventType {
+	case "BOOKMARK":
+		return
+	case "ERROR":
+		c := change{time: receivedAt, eventType: eventType, kind: "Status", message: statusMessage(object)}
+		triggerHooks(c, nil)
+		if options.Filter.matchesEventType(eventType) {
+			emit(c)
+		}
+		return
+	}
 
-	kind := object["kind"].(string)
-	if strings.HasSuffix(kind, "List") && object["items"] != nil {
-		for _, item := range object["items"].([]interface{}) {
-			processObject(item.(map[string]interface{}), eventType)
+	kind, _ := object["kind"].(string)
+	if items, ok := object["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+		for _, item := range items {
+			if itemObject, ok := item.(map[string]interface{}); ok {
+				processObject(itemObject, eventType, receivedAt)
+			}
 		}
 	} else {
-		processObject(object, eventType)
+		processObject(object, eventType, receivedAt)
 	}
 }
 
-func processObject(object map[string]interface{}, eventType string) {
-	kind := object["kind"].(string)
-	metadata := object["metadata"].(map[string]interface{})
+// statusMessage describes the Status object carried by an ERROR watch event
+func statusMessage(status map[string]interface{}) string {
+	message, _ := status["message"].(string)
+	if message == "" {
+		message = "unknown error"
+	}
+	var details []string
+	if reason, _ := status["reason"].(string); reason != "" {
+		details = append(details, reason)
+	}
+	if code, ok := status["code"].(float64); ok {
+		details = append(details, strconv.FormatFloat(code, 'f', -1, 64))
+	}
+	if len(details) > 0 {
+		message += " (" + strings.Join(details, ", ") + ")"
+	}
+	return message
+}
+
+// truncate shortens a string to at most n bytes, for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func processObject(object map[string]interface{}, eventType string, receivedAt time.Time) {
+	kind, _ := object["kind"].(string)
+	metadata, ok := object["metadata"].(map[string]interface{})
+	if kind == "" || !ok {
+		fmt.Fprintf(os.Stderr, "Warn: skipping %s object without a kind or metadata\n", eventType)
+		return
+	}
 
 	// Get values with nil checks
 	var namespace, name, uid string
 
 	// Handle namespace - it might be nil for cluster-scoped resources
-	if ns, exists := metadata["namespace"]; exists && ns != nil {
-		namespace = ns.(string)
-	} else {
-		namespace = "<no-namespace>"
+	if ns, ok := metadata["namespace"].(string); ok {
+		namespace = ns
 	}
 
 	// Handle name - required field in Kubernetes
-	if n, exists := metadata["name"]; exists && n != nil {
-		name = n.(string)
+	if n, ok := metadata["name"].(string); ok && n != "" {
+		name = n
 	} else {
 		name = "<no-name>"
 	}
 
 	// Handle UID - required field in Kubernetes
-	if u, exists := metadata["uid"]; exists && u != nil {
-		uid = u.(string)
+	if u, ok := metadata["uid"].(string); ok && u != "" {
+		uid = u
 	} else {
-		uid = fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+		uid = fmt.Sprintf("%s/%s/%s", kind, namespaceOrPlaceholder(namespace), name)
+	}
+
+	// Hooks have their own match rules, and every revision is stored, so that only
+	// the output is subject to the filters
+	visible := options.Filter.matches(kind, namespace, name)
+	if !visible && len(hooks) == 0 && !options.StoreRevisions {
+		return
+	}
+	apiVersion, _ := object["apiVersion"].(string)
+
+	stripIgnoredFields(object)
+	applyIgnoreRules(kind, object)
+	protectSecrets(kind, object)
+
+	c := change{
+		time:       receivedAt,
+		eventType:  eventType,
+		kind:       kind,
+		namespace:  namespace,
+		name:       name,
+		uid:        uid,
+		apiVersion: apiVersion,
+	}
+
+	show := func(c change) {
+		if visible && options.Filter.matchesChange(c, object) {
+			emit(c)
+		}
 	}
 
-	// Remove managedFields and resourceVersion
-	delete(metadata, "managedFields")
-	delete(metadata, "resourceVersion")
-	currentTime := faintWhite.Sprintf(time.Now().Format(time.StampMilli) + " ")
+	// firstListed is set when the object is first seen in a list
+	firstListed := false
+
+	// observed handles a change of the object, which is shown, and sent to the hooks,
+	// unless it is compared with its manifest instead
+	observed := func(c change) {
+		storeRevision(c)
+		if manifests == nil {
+			if !firstListed {
+				triggerHooks(c, object)
+			}
+			show(c)
+		}
+	}
+	if manifests != nil {
+		defer checkDrift(c, object, func(c change) {
+			if !firstListed {
+				triggerHooks(c, object)
+			}
+			show(c)
+		})
+	}
 
 	modified := func() {
-		oldValue, ok := oldValues[uid]
+		oldValue, ok := tracked.get(uid, receivedAt)
+		newValue := mustMarshalJson(object)
+		tracked.set(uid, newValue, receivedAt)
 		if !ok {
-			fmt.Printf("Error: No old value for uid %s\n", uid)
+			if !visible || manifests != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Warn: no previous state of %s %s/%s, its changes are shown from now on\n", kind, namespaceOrPlaceholder(namespace), name)
 			return
 		}
-		newValue := mustMarshalJson(object)
-		oldValues[uid] = newValue
-
-		diffText := renderDiff(oldValue, newValue)
-		if diffText != "" {
-			fmt.Printf(currentTime+boldYellow.Sprintf("MODIFIED")+": %s %s/%s\n%s\n", kind, namespace, name, diffText)
+		if newValue == oldValue {
+			return
 		}
+
+		c.eventType = "MODIFIED"
+		c.oldValue, c.newValue = oldValue, newValue
+		observed(c)
 	}
 
 	switch eventType {
 	case "ADDED":
-		if oldValues[uid] != "" {
+		if _, ok := tracked.get(uid, receivedAt); ok {
 			modified()
 		} else {
-			oldValues[uid] = mustMarshalJson(object)
-			if printBodyOfAdded {
-				fmt.Printf(currentTime+boldGreen.Sprintf("ADDED")+": %s %s/%s - %s\n", kind, namespace, name, color.GreenString(oldValues[uid]))
-			} else {
-				fmt.Printf(currentTime+boldGreen.Sprintf("ADDED")+": %s %s/%s\n", kind, namespace, name)
-			}
+			firstListed = listing
+			c.newValue = mustMarshalJson(object)
+			tracked.set(uid, c.newValue, receivedAt)
+			observed(c)
 		}
 	case "MODIFIED":
 		modified()
 	case "DELETED":
-		fmt.Printf(currentTime+boldRed.Sprintf("DELETED")+": %s %s/%s\n", kind, namespace, name)
+		// The final state of the object is kept on the change, and its last seen
+		// state released, so that a new object with the same key starts afresh
+		c.oldValue, _ = tracked.remove(uid)
+		c.newValue = mustMarshalJson(object)
+		// Objects found gone by a re-list only have their identity, their last seen
+		// state is the final one we know
+		if listing && c.oldValue != "" {
+			c.newValue = c.oldValue
+			object, _ = unmarshalValue(c.oldValue).(map[string]interface{})
+		}
+		observed(c)
+	default:
+		observed(c)
+	}
+}
+
+// change is an event that made it through processObject, along with the state of
+// the object before and after it, as marshaled JSON ("" when there is none)
+type change struct {
+	time      time.Time
+	eventType string
+	kind      string
+	namespace string
+	name      string
+	uid       string
+	// apiVersion is the group and version of kind
+	apiVersion string
+	oldValue   string
+	newValue   string
+	// message is set on ERROR events, and is the manifest file on DRIFTED and SYNCED ones
+	message string
+	// missing is set on the DRIFTED changes of manifests without an object
+	missing bool
+}
+
+// quiet suppresses the output while the state is being brought up to date
+var quiet bool
+
+// listing is set while the objects of an initial list, or of a re-list, are
+// processed. The objects first seen then are the state the watch starts from
+// rather than changes, so they don't trigger hooks.
+var listing bool
+
+// initialListGap is how long no event arrives before the initial list of objects
+// is considered complete, when the events are read from stdin or a recording
+const initialListGap = time.Second
+
+// emit outputs a change in the selected output format
+func emit(c change) {
+	if quiet {
+		return
+	}
+
+	switch options.Output {
+	case OutputJSONL:
+		printJSONL(c)
+	case OutputSummary:
+		currentSummary.add(c)
+	case OutputTUI:
+		currentTUI.add(c)
+	default:
+		printText(c)
+	}
+}
+
+// printText prints a change for humans, as a colored diff
+func printText(c change) {
+	coloredKind := kindColor(c.kind).Sprint(c.kind)
+	currentTime := colors.Faint.Sprintf(c.time.Format(time.StampMilli) + " ")
+
+	namespace := namespaceOrPlaceholder(c.namespace)
+
+	switch c.eventType {
+	case "ADDED":
+		if printBodyOfAdded {
+			fmt.Printf(currentTime+colors.AddedLabel.Sprintf("ADDED")+": %s %s/%s - %s\n", coloredKind, namespace, c.name, colors.Added.Sprint(formatBody(c.newValue)))
+		} else {
+			fmt.Printf(currentTime+colors.AddedLabel.Sprintf("ADDED")+": %s %s/%s\n", coloredKind, namespace, c.name)
+		}
+	case "MODIFIED":
+		fmt.Printf(currentTime+colors.ModifiedLabel.Sprintf("MODIFIED")+": %s %s/%s\n%s\n", coloredKind, namespace, c.name, renderModification(c.kind, c.oldValue, c.newValue))
+	case "DELETED":
+		switch {
+		case options.OnDelete == OnDeleteBody:
+			fmt.Printf(currentTime+colors.RemovedLabel.Sprintf("DELETED")+": %s %s/%s - %s\n", coloredKind, namespace, c.name, colors.Removed.Sprint(formatBody(c.newValue)))
+		case options.OnDelete == OnDeleteDiff && c.oldValue != "" && c.oldValue != c.newValue:
+			fmt.Printf(currentTime+colors.RemovedLabel.Sprintf("DELETED")+": %s %s/%s\n%s\n", coloredKind, namespace, c.name, renderChange(c.oldValue, c.newValue))
+		default:
+			fmt.Printf(currentTime+colors.RemovedLabel.Sprintf("DELETED")+": %s %s/%s\n", coloredKind, namespace, c.name)
+		}
+	case "DRIFTED":
+		fmt.Printf(currentTime+colors.ModifiedLabel.Sprintf("DRIFTED")+": %s %s/%s\n%s\n", coloredKind, namespace, c.name, renderDrift(c))
+	case "SYNCED":
+		fmt.Printf(currentTime+colors.AddedLabel.Sprintf("SYNCED")+": %s %s/%s\n", coloredKind, namespace, c.name)
+	case "ERROR":
+		fmt.Printf(currentTime+colors.RemovedLabel.Sprintf("ERROR")+": %s\n", c.message)
 	default:
-		fmt.Printf(currentTime+"Unknown event type: %s\n", eventType)
+		fmt.Printf(currentTime+"Unknown event type: %s\n", c.eventType)
+	}
+}
+
+// renderChange renders the changes between two states of an object in the selected diff mode
+func renderChange(oldValue, newValue string) string {
+	oldValue, newValue = expandForDiff(oldValue), expandForDiff(newValue)
+	if options.DiffMode == DiffModeField {
+		return renderFieldDiff(oldValue, newValue)
 	}
+	return renderDiff(formatBody(oldValue), formatBody(newValue))
+}
+
+func namespaceOrPlaceholder(namespace string) string {
+	if namespace == "" {
+		return "<no-namespace>"
+	}
+	return namespace
+}
+
+// stripIgnoredFields removes the fields that change all the time but carry no information
+func stripIgnoredFields(object map[string]interface{}) {
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+		delete(metadata, "resourceVersion")
+	}
+}
+
+// RenderObjectDiff renders the colored diff between two versions of an object the
+// same way watch-changes does. Either object may be nil, in which case the whole
+// other object shows up as added or removed. It returns "" if nothing changed.
+func RenderObjectDiff(oldObject, newObject map[string]interface{}) string {
+	marshal := func(object map[string]interface{}) string {
+		if object == nil {
+			return ""
+		}
+		stripIgnoredFields(object)
+		kind, _ := object["kind"].(string)
+		protectSecrets(kind, object)
+		return mustMarshalJson(object)
+	}
+
+	oldValue, newValue := marshal(oldObject), marshal(newObject)
+	if oldValue == newValue {
+		return ""
+	}
+	return renderDiff(formatBody(oldValue), formatBody(newValue))
+}
+
+// formatBody converts a marshaled object to the selected format. YAML keys are
+// sorted, like the JSON ones, so that diffs stay minimal.
+func formatBody(value string) string {
+	if options.Format != FormatYAML || value == "" {
+		return value
+	}
+	result, err := yaml.JSONToYAML([]byte(value))
+	if err != nil {
+		panic(fmt.Errorf("failed to convert to yaml: %w", err))
+	}
+	return string(result)
 }
 
 func renderDiff(oldValue string, newValue string) string {
-	oldLines := difflib.SplitLines(oldValue)
-	newLines := difflib.SplitLines(newValue)
+	oldLines := splitLines(oldValue)
+	newLines := splitLines(newValue)
 
 	context := contextLines
 	if context == -1 {
@@ -169,24 +569,68 @@ func renderDiff(oldValue string, newValue string) string {
 	return colorizeDiff(diffString)
 }
 
+// splitLines splits a value into lines for diffing, an empty value has no lines at all
+func splitLines(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return difflib.SplitLines(value)
+}
+
 func mustMarshalJson(value interface{}) string {
-	result, err := json.MarshalIndent(value, "", "  ")
-	if err != nil {
+	return marshalJson(value, "  ")
+}
+
+// marshalJson marshals a value without escaping <, > and &, which would make
+// values such as URLs and redacted fields hard to read
+func marshalJson(value interface{}, indent string) string {
+	var result bytes.Buffer
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(value); err != nil {
 		panic(err)
 	}
-	return string(result)
+	return strings.TrimSuffix(result.String(), "\n")
 }
 
+// colorizeDiff colors removed and added lines. When lines are replaced, the words
+// that changed are highlighted within them.
 func colorizeDiff(diffString string) string {
 	var colorizedDiff strings.Builder
-	for _, line := range strings.Split(diffString, "\n") {
-		switch {
-		case strings.HasPrefix(line, "+"):
-			colorizedDiff.WriteString("\033[32m" + line + "\033[0m\n") // Green for additions
-		case strings.HasPrefix(line, "-"):
-			colorizedDiff.WriteString("\033[31m" + line + "\033[0m\n") // Red for deletions
-		default:
-			colorizedDiff.WriteString(line + "\n")
+	lines := strings.Split(diffString, "\n")
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if !strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "+") {
+			if len(line) > 0 {
+				colorizedDiff.WriteString(renderSpans(line[:1], []span{{text: line[1:]}}, nil, nil))
+			}
+			colorizedDiff.WriteString("\n")
+			i++
+			continue
+		}
+
+		// A block of removed lines, followed by the added lines replacing them
+		var removed, added []string
+		for ; i < len(lines) && strings.HasPrefix(lines[i], "-"); i++ {
+			removed = append(removed, lines[i][1:])
+		}
+		for ; i < len(lines) && strings.HasPrefix(lines[i], "+"); i++ {
+			added = append(added, lines[i][1:])
+		}
+
+		removedSpans, addedSpans := wholeLines(removed), wholeLines(added)
+		for j := 0; j < len(removed) && j < len(added); j++ {
+			if oldSpans, newSpans, ok := diffWords(removed[j], added[j]); ok {
+				removedSpans[j], addedSpans[j] = oldSpans, newSpans
+			}
+		}
+
+		for _, spans := range removedSpans {
+			colorizedDiff.WriteString(renderSpans("-", spans, colors.Removed, colors.RemovedHighlight) + "\n")
+		}
+		for _, spans := range addedSpans {
+			colorizedDiff.WriteString(renderSpans("+", spans, colors.Added, colors.AddedHighlight) + "\n")
 		}
 	}
 	return colorizedDiff.String()
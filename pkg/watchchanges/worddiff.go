@@ -0,0 +1,189 @@
+package watchchanges
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/KevinWang15/k/pkg/consts"
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// minWordDiffRatio is how similar two lines have to be for their changed words to be
+// highlighted, below it they are shown as a whole line removed and a whole line added
+const minWordDiffRatio = 0.3
+
+// maxLineLength is the number of characters diff lines are cut to, 0 (the default)
+// means no limit
+var maxLineLength = (func() int {
+	env := os.Getenv(consts.K_DIFF_MAX_LINE_LENGTH)
+	if env == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(env)
+	if err != nil {
+		panic(fmt.Errorf("failed to parse %s: %w", consts.K_DIFF_MAX_LINE_LENGTH, err))
+	}
+	return v
+})()
+
+// span is a part of a line, changed or not
+type span struct {
+	text    string
+	changed bool
+}
+
+// tokenize splits a line into words, runs of spaces and single other characters,
+// so that a change in a long string only highlights the words that changed
+func tokenize(s string) []string {
+	var tokens []string
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		end := size
+		switch {
+		case isWordRune(r):
+			for end < len(s) {
+				next, nextSize := utf8.DecodeRuneInString(s[end:])
+				if !isWordRune(next) {
+					break
+				}
+				end += nextSize
+			}
+		case unicode.IsSpace(r):
+			for end < len(s) {
+				next, nextSize := utf8.DecodeRuneInString(s[end:])
+				if !unicode.IsSpace(next) {
+					break
+				}
+				end += nextSize
+			}
+		}
+		tokens = append(tokens, s[:end])
+		s = s[end:]
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// diffWords finds the words that differ between a removed and an added line. It
+// returns false if the lines have too little in common for that to be useful.
+func diffWords(oldLine, newLine string) ([]span, []span, bool) {
+	oldTokens, newTokens := tokenize(oldLine), tokenize(newLine)
+	matcher := difflib.NewMatcher(oldTokens, newTokens)
+	if matcher.Ratio() < minWordDiffRatio {
+		return nil, nil, false
+	}
+
+	var oldSpans, newSpans []span
+	for _, op := range matcher.GetOpCodes() {
+		oldText := strings.Join(oldTokens[op.I1:op.I2], "")
+		newText := strings.Join(newTokens[op.J1:op.J2], "")
+		changed := op.Tag != 'e'
+		oldSpans = appendSpan(oldSpans, span{text: oldText, changed: changed})
+		newSpans = appendSpan(newSpans, span{text: newText, changed: changed})
+	}
+	return oldSpans, newSpans, true
+}
+
+// wholeLines turns lines into spans without highlighting
+func wholeLines(lines []string) [][]span {
+	result := make([][]span, len(lines))
+	for i, line := range lines {
+		result[i] = []span{{text: line}}
+	}
+	return result
+}
+
+// appendSpan appends a span, merging it with the previous one if they are alike
+func appendSpan(spans []span, s span) []span {
+	if s.text == "" {
+		return spans
+	}
+	if n := len(spans); n > 0 && spans[n-1].changed == s.changed {
+		spans[n-1].text += s.text
+		return spans
+	}
+	return append(spans, s)
+}
+
+// fitSpans cuts spans to maxLineLength characters. The window is placed so that the
+// first changed span is visible, and widened so that the last one is too, and marked
+// with … where the line was cut.
+func fitSpans(spans []span) []span {
+	total := 0
+	changeStart, changeEnd := -1, 0
+	for _, s := range spans {
+		length := utf8.RuneCountInString(s.text)
+		if s.changed {
+			if changeStart < 0 {
+				changeStart = total
+			}
+			changeEnd = total + length
+		}
+		total += length
+	}
+	if maxLineLength <= 0 || total <= maxLineLength {
+		return spans
+	}
+
+	start := 0
+	if changeStart > maxLineLength/4 {
+		start = changeStart - maxLineLength/4
+	}
+	end := start + maxLineLength
+	if end > total {
+		end, start = total, total-maxLineLength
+	}
+	if end < changeEnd {
+		end = changeEnd
+	}
+
+	var result []span
+	if start > 0 {
+		result = append(result, span{text: "…"})
+	}
+	position := 0
+	for _, s := range spans {
+		runes := []rune(s.text)
+		from, to := clamp(start-position, 0, len(runes)), clamp(end-position, 0, len(runes))
+		if from < to {
+			result = appendSpan(result, span{text: string(runes[from:to]), changed: s.changed})
+		}
+		position += len(runes)
+	}
+	if end < total {
+		result = appendSpan(result, span{text: "…"})
+	}
+	return result
+}
+
+// renderSpans renders a diff line in its color, with the changed spans highlighted.
+// A nil lineColor renders the line as is.
+func renderSpans(prefix string, spans []span, lineColor, highlightColor *color.Color) string {
+	if lineColor == nil {
+		var result strings.Builder
+		result.WriteString(prefix)
+		for _, s := range fitSpans(spans) {
+			result.WriteString(s.text)
+		}
+		return result.String()
+	}
+
+	var result strings.Builder
+	result.WriteString(lineColor.Sprint(prefix))
+	for _, s := range fitSpans(spans) {
+		if s.changed {
+			result.WriteString(highlightColor.Sprint(s.text))
+		} else {
+			result.WriteString(lineColor.Sprint(s.text))
+		}
+	}
+	return result.String()
+}